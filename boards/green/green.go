@@ -1,23 +1,36 @@
 package green
 
 import (
+	"time"
+
 	"github.com/godbus/dbus/v5"
 	"github.com/godbus/dbus/v5/introspect"
 	"github.com/godbus/dbus/v5/prop"
 
+	"github.com/home-assistant/os-agent/utils/filehistory"
 	"github.com/home-assistant/os-agent/utils/led"
 	logging "github.com/home-assistant/os-agent/utils/log"
+	"github.com/home-assistant/os-agent/utils/settings"
 )
 
 const (
 	objectPath = "/io/hass/os/Boards/Green"
 	ifaceName  = "io.hass.os.Boards.Green"
+
+	ledRefreshInterval = 10 * time.Second
 )
 
 var (
 	ledPower    led.LED = led.LED{Name: "power", DefaultTrigger: "default-on"}
 	ledActivity led.LED = led.LED{Name: "activity", DefaultTrigger: "activity"}
 	ledUser     led.LED = led.LED{Name: "user", DefaultTrigger: "heartbeat"}
+
+	// leds are the LEDs by the property controlling them.
+	leds = map[string]led.LED{
+		"PowerLED":    ledPower,
+		"ActivityLED": ledActivity,
+		"UserLED":     ledUser,
+	}
 )
 
 type green struct {
@@ -54,6 +67,21 @@ func setUserLED(c *prop.Change) *dbus.Error {
 	return setTriggerLED(ledUser, c)
 }
 
+// readLEDs returns the state of all LEDs by property.
+func readLEDs() map[string]any {
+	values := map[string]any{}
+	for property, led := range leds {
+		values[property] = getTriggerLED(led)
+	}
+	return values
+}
+
+// refreshLEDs updates the properties of LEDs whose trigger was changed
+// through sysfs.
+func (d green) refreshLEDs() {
+	settings.Refresh(d.props, ifaceName, readLEDs())
+}
+
 func InitializeDBus(conn *dbus.Conn) {
 	d := green{
 		conn: conn,
@@ -92,6 +120,13 @@ func InitializeDBus(conn *dbus.Conn) {
 		logging.Critical.Panic(err)
 	}
 	d.props = props
+	// The LED triggers live in sysfs, there are no files to record
+	settings.Register(ifaceName, props, []string{"PowerLED", "ActivityLED", "UserLED"}, nil, nil)
+
+	err = filehistory.ExportProperties(conn, objectPath, props, nil)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
 
 	err = conn.Export(d, objectPath, ifaceName)
 	if err != nil {
@@ -117,4 +152,11 @@ func InitializeDBus(conn *dbus.Conn) {
 	}
 
 	logging.Info.Printf("Exposing object %s with interface %s ...", objectPath, ifaceName)
+
+	// sysfs attributes don't support inotify, the triggers are polled instead
+	go func() {
+		for range time.Tick(ledRefreshInterval) {
+			d.refreshLEDs()
+		}
+	}()
 }
@@ -0,0 +1,44 @@
+package green
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/home-assistant/os-agent/utils/led"
+)
+
+func writeTrigger(t *testing.T, name string, trigger string) {
+	t.Helper()
+	dir := filepath.Join(led.ClassPath, name)
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "trigger"), []byte(trigger+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadLEDs(t *testing.T) {
+	previous := led.ClassPath
+	led.ClassPath = t.TempDir()
+	t.Cleanup(func() { led.ClassPath = previous })
+
+	writeTrigger(t, "power", "default-on")
+	writeTrigger(t, "activity", "none")
+	writeTrigger(t, "user", "heartbeat")
+
+	values := readLEDs()
+	if values["PowerLED"] != true || values["ActivityLED"] != false || values["UserLED"] != true {
+		t.Errorf("unexpected values %v", values)
+	}
+
+	// A trigger changed through sysfs is picked up by the next refresh
+	writeTrigger(t, "user", "none")
+	writeTrigger(t, "activity", "activity")
+
+	values = readLEDs()
+	if values["PowerLED"] != true || values["ActivityLED"] != true || values["UserLED"] != false {
+		t.Errorf("unexpected values after trigger change %v", values)
+	}
+}
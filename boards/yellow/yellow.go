@@ -6,7 +6,10 @@ import (
 	"github.com/godbus/dbus/v5/prop"
 
 	"github.com/home-assistant/os-agent/utils/bootfile"
+	"github.com/home-assistant/os-agent/utils/filehistory"
+	"github.com/home-assistant/os-agent/utils/filewatch"
 	logging "github.com/home-assistant/os-agent/utils/log"
+	"github.com/home-assistant/os-agent/utils/settings"
 )
 
 const (
@@ -93,6 +96,18 @@ func setStatusLEDHeartbeat(c *prop.Change) *dbus.Error {
 	return nil
 }
 
+// refreshLEDs re-reads the LED settings after config.txt was changed, e.g.
+// by hand on the boot partition. It runs on the watcher goroutine, so it only
+// updates the properties and leaves the package variables to the property
+// callbacks.
+func (d yellow) refreshLEDs() {
+	settings.Refresh(d.props, ifaceName, map[string]any{
+		"PowerLED":     getStatusLEDPower(),
+		"DiskLED":      getStatusLEDDisk(),
+		"HeartbeatLED": getStatusLEDHeartbeat(),
+	})
+}
+
 func InitializeDBus(conn *dbus.Conn) {
 	d := yellow{
 		conn: conn,
@@ -131,6 +146,13 @@ func InitializeDBus(conn *dbus.Conn) {
 		logging.Critical.Panic(err)
 	}
 	d.props = props
+	files := []string{bootConfig}
+	settings.Register(ifaceName, props, []string{"PowerLED", "DiskLED", "HeartbeatLED"}, files, nil)
+
+	err = filehistory.ExportProperties(conn, objectPath, props, files)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
 
 	err = conn.Export(d, objectPath, ifaceName)
 	if err != nil {
@@ -156,4 +178,8 @@ func InitializeDBus(conn *dbus.Conn) {
 	}
 
 	logging.Info.Printf("Exposing object %s with interface %s ...", objectPath, ifaceName)
+
+	if err := filewatch.Watch(bootConfig, d.refreshLEDs); err != nil {
+		logging.Warning.Printf("Failed to watch %s: %s", bootConfig, err)
+	}
 }
@@ -0,0 +1,296 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/home-assistant/os-agent/config/sysctl"
+	"github.com/home-assistant/os-agent/system"
+	"github.com/home-assistant/os-agent/utils/filehistory"
+	logging "github.com/home-assistant/os-agent/utils/log"
+	"github.com/home-assistant/os-agent/utils/settings"
+)
+
+const (
+	objectPath = "/io/hass/os/Config"
+	ifaceName  = "io.hass.os.Config"
+	// ifacePrefix is prepended to the setting keys, e.g. "Config.Swap.SwapSize"
+	// refers to the SwapSize property of io.hass.os.Config.Swap.
+	ifacePrefix = "io.hass.os."
+	// configurationVersion is the format version of exported configurations.
+	configurationVersion = 1
+)
+
+// The parts of a configuration besides the settings are imported through
+// these, so they can be replaced in tests.
+var (
+	sysctlFile         = sysctl.SettingsFile()
+	sshAuthKeysFile    = system.SSHAuthKeysFile()
+	replaceSysctl      = sysctl.ReplaceSettings
+	reloadSysctl       = sysctl.Reload
+	replaceSSHAuthKeys = system.ReplaceSSHAuthKeys
+)
+
+type config struct {
+	conn  *dbus.Conn
+	board string
+}
+
+// configuration is the document of ExportConfiguration. Settings use the
+// keys of ApplyConfig, Sysctl holds the kernel parameters persisted through
+// Config.Sysctl. Without Sysctl or SSHAuthorizedKeys an import keeps the
+// current values, an empty one removes them.
+type configuration struct {
+	Version           int                        `json:"version"`
+	Board             string                     `json:"board"`
+	Settings          map[string]json.RawMessage `json:"settings"`
+	Sysctl            map[string]string          `json:"sysctl"`
+	SSHAuthorizedKeys []string                   `json:"ssh_authorized_keys"`
+}
+
+// ApplyConfig changes several settings at once. Keys name the property below
+// io.hass.os, e.g. "Config.Swap.Swappiness" or "Boards.Yellow.PowerLED". All
+// values are validated before the first one is written, and settings written
+// already are restored if a later one fails.
+func (d config) ApplyConfig(sender dbus.Sender, values map[string]dbus.Variant) *dbus.Error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changes := make([]settings.Change, 0, len(values))
+	for _, key := range keys {
+		iface, property, err := settings.ParseKey(ifacePrefix, key)
+		if err != nil {
+			return dbus.MakeFailedError(err)
+		}
+		changes = append(changes, settings.Change{Interface: iface, Property: property, Value: values[key]})
+	}
+
+	err := filehistory.Track(string(sender), settings.Files(changes), func() error {
+		return settings.Apply(changes)
+	})
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	logging.Info.Printf("Applied configuration %s", strings.Join(keys, ", "))
+	return nil
+}
+
+// exportConfiguration collects all settings managed through the registry
+// along with the sysctl settings and the authorized SSH keys.
+func exportConfiguration(board string) (configuration, error) {
+	values, err := settings.Values()
+	if err != nil {
+		return configuration{}, err
+	}
+
+	doc := configuration{
+		Version:  configurationVersion,
+		Board:    board,
+		Settings: map[string]json.RawMessage{},
+	}
+	for key, value := range values {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return configuration{}, fmt.Errorf("failed to encode %s: %w", key, err)
+		}
+		doc.Settings[strings.TrimPrefix(key, ifacePrefix)] = raw
+	}
+
+	doc.Sysctl = sysctl.Settings()
+
+	doc.SSHAuthorizedKeys, err = system.SSHAuthKeys()
+	if err != nil {
+		return configuration{}, fmt.Errorf("failed to read SSH authorized keys: %w", err)
+	}
+
+	return doc, nil
+}
+
+// parseConfiguration decodes an exported configuration into the changes to
+// apply. Settings of interfaces not available on this system, e.g. the LEDs
+// of another board, are returned as skipped.
+func parseConfiguration(content string) (configuration, []settings.Change, []string, error) {
+	var doc configuration
+	if err := json.Unmarshal([]byte(content), &doc); err != nil {
+		return configuration{}, nil, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if doc.Version < 1 || doc.Version > configurationVersion {
+		return configuration{}, nil, nil, fmt.Errorf("unsupported configuration version %d", doc.Version)
+	}
+
+	keys := make([]string, 0, len(doc.Settings))
+	for key := range doc.Settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changes := []settings.Change{}
+	skipped := []string{}
+	for _, key := range keys {
+		iface, property, err := settings.ParseKey(ifacePrefix, key)
+		if err != nil {
+			return configuration{}, nil, nil, err
+		}
+		if !settings.Supported(iface) {
+			skipped = append(skipped, key)
+			continue
+		}
+
+		current, err := settings.Current(iface, property)
+		if err != nil {
+			return configuration{}, nil, nil, err
+		}
+
+		// Decode into the type of the property, JSON numbers and arrays are
+		// ambiguous otherwise.
+		value := reflect.New(reflect.TypeOf(current.Value()))
+		if err := json.Unmarshal(doc.Settings[key], value.Interface()); err != nil {
+			return configuration{}, nil, nil, fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+		changes = append(changes, settings.Change{Interface: iface, Property: property, Value: dbus.MakeVariant(value.Elem().Interface())})
+	}
+
+	return doc, changes, skipped, nil
+}
+
+// ExportConfiguration returns all settings managed by the agent as a
+// versioned JSON document, to be restored with ImportConfiguration.
+func (d config) ExportConfiguration() (string, *dbus.Error) {
+	doc, err := exportConfiguration(d.board)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+
+	content, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+
+	return string(content), nil
+}
+
+// validateConfiguration checks all parts of a parsed configuration before
+// anything is written.
+func validateConfiguration(doc configuration, changes []settings.Change) error {
+	if err := settings.Validate(changes); err != nil {
+		return err
+	}
+	if doc.Sysctl != nil {
+		if err := sysctl.ValidateSettings(doc.Sysctl); err != nil {
+			return err
+		}
+	}
+	if doc.SSHAuthorizedKeys != nil {
+		if err := system.ValidateSSHAuthKeys(doc.SSHAuthorizedKeys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importConfiguration applies a parsed configuration completely or not at
+// all. The sysctl settings and SSH keys go first and their files are restored
+// if a later step fails, the settings go last as Apply undoes its own writes.
+func importConfiguration(doc configuration, changes []settings.Change) error {
+	if err := validateConfiguration(doc, changes); err != nil {
+		return err
+	}
+
+	snapshot, err := filehistory.TakeSnapshot([]string{sysctlFile, sshAuthKeysFile})
+	if err != nil {
+		return fmt.Errorf("failed to read the current configuration: %w", err)
+	}
+
+	err = func() error {
+		if doc.Sysctl != nil {
+			if err := replaceSysctl(doc.Sysctl); err != nil {
+				return fmt.Errorf("failed to import the sysctl settings: %w", err)
+			}
+		}
+		if doc.SSHAuthorizedKeys != nil {
+			if err := replaceSSHAuthKeys(doc.SSHAuthorizedKeys); err != nil {
+				return fmt.Errorf("failed to import the SSH authorized keys: %w", err)
+			}
+		}
+		return settings.Apply(changes)
+	}()
+	if err != nil {
+		if restoreErr := snapshot.Restore(); restoreErr != nil {
+			logging.Error.Printf("Failed to restore the configuration: %s", restoreErr)
+		}
+		if doc.Sysctl != nil {
+			if reloadErr := reloadSysctl(); reloadErr != nil {
+				logging.Error.Printf("Failed to reload the sysctl settings: %s", reloadErr)
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ImportConfiguration applies a document of ExportConfiguration like
+// ApplyConfig does. Settings not supported on this system are skipped and
+// returned.
+func (d config) ImportConfiguration(sender dbus.Sender, content string) ([]string, *dbus.Error) {
+	doc, changes, skipped, err := parseConfiguration(content)
+	if err != nil {
+		return nil, dbus.MakeFailedError(err)
+	}
+
+	files := append(settings.Files(changes), sysctlFile, sshAuthKeysFile)
+	err = filehistory.Track(string(sender), files, func() error {
+		return importConfiguration(doc, changes)
+	})
+	if err != nil {
+		return nil, dbus.MakeFailedError(err)
+	}
+
+	for _, key := range skipped {
+		logging.Info.Printf("Skipped %s, not supported on board %s", key, d.board)
+	}
+	logging.Info.Printf("Imported configuration of board %s with %d settings", doc.Board, len(changes))
+	return skipped, nil
+}
+
+func InitializeDBus(conn *dbus.Conn, board string) {
+	d := config{
+		conn:  conn,
+		board: board,
+	}
+
+	err := conn.Export(d, objectPath, ifaceName)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	node := &introspect.Node{
+		Name: objectPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:    ifaceName,
+				Methods: introspect.Methods(d),
+			},
+		},
+	}
+
+	err = conn.Export(introspect.NewIntrospectable(node), objectPath, "org.freedesktop.DBus.Introspectable")
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	logging.Info.Printf("Exposing object %s with interface %s ...", objectPath, ifaceName)
+}
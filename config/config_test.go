@@ -0,0 +1,192 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/home-assistant/os-agent/utils/settings"
+)
+
+type fakeProperties map[string]any
+
+func (p fakeProperties) Get(iface string, property string) (dbus.Variant, *dbus.Error) {
+	value, ok := p[property]
+	if !ok {
+		return dbus.Variant{}, dbus.MakeFailedError(errors.New("unknown property"))
+	}
+	return dbus.MakeVariant(value), nil
+}
+
+func (p fakeProperties) Set(iface string, property string, value dbus.Variant) *dbus.Error {
+	p[property] = value.Value()
+	return nil
+}
+
+func init() {
+	settings.Register("io.hass.os.Config.Test", fakeProperties{
+		"Swappiness": int32(60),
+		"Interval":   uint32(32),
+		"Servers":    []string{"time.example.com"},
+		"LED":        true,
+	}, []string{"Swappiness", "Interval", "Servers", "LED"}, nil, nil)
+}
+
+func TestParseConfiguration(t *testing.T) {
+	content := `{
+		"version": 1,
+		"board": "Yellow",
+		"settings": {
+			"Config.Test.Swappiness": 10,
+			"Config.Test.Interval": 64,
+			"Config.Test.Servers": ["a.example.com", "b.example.com"],
+			"Boards.Yellow.PowerLED": false
+		}
+	}`
+
+	doc, changes, skipped, err := parseConfiguration(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.SSHAuthorizedKeys != nil {
+		t.Errorf("expected SSH keys to be left alone, got %v", doc.SSHAuthorizedKeys)
+	}
+	if doc.Sysctl != nil {
+		t.Errorf("expected sysctl settings to be left alone, got %v", doc.Sysctl)
+	}
+	if len(skipped) != 1 || skipped[0] != "Boards.Yellow.PowerLED" {
+		t.Errorf("unexpected skipped settings %v", skipped)
+	}
+
+	expected := map[string]string{"Interval": "u", "Servers": "as", "Swappiness": "i"}
+	if len(changes) != len(expected) {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+	for _, c := range changes {
+		if c.Interface != "io.hass.os.Config.Test" || c.Value.Signature().String() != expected[c.Property] {
+			t.Errorf("unexpected change %s.%s of type %s", c.Interface, c.Property, c.Value.Signature())
+		}
+	}
+}
+
+func TestParseConfigurationInvalid(t *testing.T) {
+	invalid := []string{
+		`not json`,
+		`{"settings": {}}`,
+		`{"version": 2, "settings": {}}`,
+		`{"version": 1, "settings": {"Config.Test.Missing": 1}}`,
+		`{"version": 1, "settings": {"Config.Test.Swappiness": "high"}}`,
+		`{"version": 1, "settings": {"Config.Test.Interval": -1}}`,
+		`{"version": 1, "settings": {"Swappiness": 1}}`,
+	}
+
+	for _, content := range invalid {
+		if _, _, _, err := parseConfiguration(content); err == nil {
+			t.Errorf("parseConfiguration(%s) expected an error", content)
+		}
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	values, err := settings.Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := configuration{Version: configurationVersion, Settings: map[string]json.RawMessage{}}
+	for key, value := range values {
+		raw, _ := json.Marshal(value)
+		doc.Settings[key[len(ifacePrefix):]] = raw
+	}
+	content, _ := json.Marshal(doc)
+
+	_, changes, skipped, err := parseConfiguration(string(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 0 || len(changes) != len(values) {
+		t.Errorf("expected all %d settings to round-trip, got %d changes and %v skipped", len(values), len(changes), skipped)
+	}
+}
+
+// failingProperties refuses every write, like a callback failing to save.
+type failingProperties struct {
+	fakeProperties
+}
+
+func (p failingProperties) Set(iface string, property string, value dbus.Variant) *dbus.Error {
+	return dbus.MakeFailedError(errors.New("write failed"))
+}
+
+func TestImportConfigurationRestoresFiles(t *testing.T) {
+	dir := t.TempDir()
+	prevSysctlFile, prevKeysFile := sysctlFile, sshAuthKeysFile
+	prevReplaceSysctl, prevReloadSysctl, prevReplaceKeys := replaceSysctl, reloadSysctl, replaceSSHAuthKeys
+	t.Cleanup(func() {
+		sysctlFile, sshAuthKeysFile = prevSysctlFile, prevKeysFile
+		replaceSysctl, reloadSysctl, replaceSSHAuthKeys = prevReplaceSysctl, prevReloadSysctl, prevReplaceKeys
+	})
+
+	sysctlFile = filepath.Join(dir, "20-os-agent.conf")
+	sshAuthKeysFile = filepath.Join(dir, "authorized_keys")
+	sysctlContent := "# tuned by hand\nfs.file-max=100000\n"
+	keysContent := "ssh-ed25519 AAAA... user@host\n"
+	for path, content := range map[string]string{sysctlFile: sysctlContent, sshAuthKeysFile: keysContent} {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reloaded := false
+	replaceSysctl = func(values map[string]string) error {
+		return os.WriteFile(sysctlFile, []byte("fs.file-max="+values["fs.file-max"]+"\n"), 0o600)
+	}
+	reloadSysctl = func() error {
+		reloaded = true
+		return nil
+	}
+	replaceSSHAuthKeys = func(keys []string) error {
+		return os.Remove(sshAuthKeysFile)
+	}
+
+	props := fakeProperties{"Swappiness": int32(60)}
+	settings.Register("io.hass.os.Config.Import", props, []string{"Swappiness"}, nil, nil)
+	settings.Register("io.hass.os.Config.Failing", failingProperties{fakeProperties{"Value": uint32(1)}}, []string{"Value"}, nil, nil)
+
+	// The settings are applied last and fail
+	doc := configuration{Version: configurationVersion, Sysctl: map[string]string{"fs.file-max": "200000"}, SSHAuthorizedKeys: []string{}}
+	changes := []settings.Change{
+		{Interface: "io.hass.os.Config.Import", Property: "Swappiness", Value: dbus.MakeVariant(int32(10))},
+		{Interface: "io.hass.os.Config.Failing", Property: "Value", Value: dbus.MakeVariant(uint32(2))},
+	}
+	if err := importConfiguration(doc, changes); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if content, _ := os.ReadFile(sysctlFile); string(content) != sysctlContent {
+		t.Errorf("expected the sysctl settings to be restored, got %q", content)
+	}
+	if content, _ := os.ReadFile(sshAuthKeysFile); string(content) != keysContent {
+		t.Errorf("expected the SSH authorized keys to be restored, got %q", content)
+	}
+	if !reloaded {
+		t.Errorf("expected the restored sysctl settings to be reloaded")
+	}
+	if props["Swappiness"] != int32(60) {
+		t.Errorf("expected the settings to be rolled back, got %v", props)
+	}
+
+	// Nothing is written if any part is invalid
+	doc.Sysctl = map[string]string{"fs.file-max": "1"}
+	changes = changes[:1]
+	if err := importConfiguration(doc, changes); err == nil {
+		t.Fatal("expected an error")
+	}
+	if content, _ := os.ReadFile(sysctlFile); string(content) != sysctlContent || props["Swappiness"] != int32(60) {
+		t.Errorf("invalid configuration was written")
+	}
+}
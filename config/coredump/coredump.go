@@ -0,0 +1,275 @@
+package coredump
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/home-assistant/os-agent/utils/filehistory"
+	"github.com/home-assistant/os-agent/utils/inifile"
+	logging "github.com/home-assistant/os-agent/utils/log"
+	"github.com/home-assistant/os-agent/utils/settings"
+)
+
+const (
+	objectPath = "/io/hass/os/Config/Coredump"
+	ifaceName  = "io.hass.os.Config.Coredump"
+	configName = "coredump.conf"
+	dropInPath = "/etc/systemd/coredump.conf.d/90-os-agent.conf"
+)
+
+var (
+	// configRoots are the directories systemd reads coredump.conf and its
+	// drop-ins from, in order of precedence.
+	configRoots = []string{"/etc/systemd", "/run/systemd", "/usr/local/lib/systemd", "/usr/lib/systemd"}
+	configFile  = inifile.IniFile{FilePath: dropInPath}
+	// dropInMu serializes modifications of the drop-in file.
+	dropInMu sync.Mutex
+
+	storageModes = []string{"none", "external", "journal"}
+
+	// sizeOptions are the managed size limits along with the systemd-coredump
+	// defaults. MaxUse and KeepFree also accept a share of the file system.
+	sizeOptions = map[string]struct {
+		defaultValue string
+		percent      bool
+	}{
+		"ProcessSizeMax":  {defaultValue: "32G"},
+		"ExternalSizeMax": {defaultValue: "32G"},
+		"MaxUse":          {defaultValue: "10%", percent: true},
+		"KeepFree":        {defaultValue: "15%", percent: true},
+	}
+
+	sizeRegexp    = regexp.MustCompile(`^(\d+[KMGTPE]?|infinity)$`)
+	percentRegexp = regexp.MustCompile(`^\d{1,2}%$`)
+)
+
+type coredump struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+}
+
+// getOption returns the effective value of an option over coredump.conf and
+// all its drop-ins, falling back to the systemd-coredump default.
+func getOption(name string, defaultValue string) string {
+	options := inifile.Merge(inifile.ConfigFiles(configRoots, configName), "Coredump", nil)
+	if value := options[name]; value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func setOption(name string, value string) error {
+	dropInMu.Lock()
+	defer dropInMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(dropInPath), 0o755); err != nil { //nolint:gosec
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(dropInPath), err)
+	}
+	if err := configFile.Set("Coredump", name, value); err != nil {
+		return fmt.Errorf("failed to set %s: %w", name, err)
+	}
+
+	logging.Info.Printf("Set coredump %s to %s", name, value)
+	return nil
+}
+
+func validateStorage(storage string) error {
+	if !slices.Contains(storageModes, storage) {
+		return fmt.Errorf("invalid storage %q (must be one of %s)", storage, strings.Join(storageModes, ", "))
+	}
+	return nil
+}
+
+func validateSize(name string, size string) error {
+	if sizeRegexp.MatchString(size) || (sizeOptions[name].percent && percentRegexp.MatchString(size)) {
+		return nil
+	}
+	return fmt.Errorf("invalid size %q for %s", size, name)
+}
+
+// validate checks new values for the writable properties, used to validate
+// all changes of a transaction before any of them is written.
+func validate(changes map[string]any) error {
+	for name, value := range changes {
+		var err error
+		switch name {
+		case "Storage":
+			err = validateStorage(value.(string))
+		case "Compress":
+		default:
+			err = validateSize(name, value.(string))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getCompress() bool {
+	switch strings.ToLower(getOption("Compress", "yes")) {
+	case "no", "false", "0", "off":
+		return false
+	default:
+		return true
+	}
+}
+
+func setStorage(c *prop.Change) *dbus.Error {
+	storage, ok := c.Value.(string)
+	if !ok {
+		return dbus.MakeFailedError(fmt.Errorf("invalid type for Storage"))
+	}
+
+	if err := validateStorage(storage); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	if err := setOption("Storage", storage); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	return nil
+}
+
+func setCompress(c *prop.Change) *dbus.Error {
+	compress, ok := c.Value.(bool)
+	if !ok {
+		return dbus.MakeFailedError(fmt.Errorf("invalid type for Compress"))
+	}
+
+	value := "no"
+	if compress {
+		value = "yes"
+	}
+	if err := setOption("Compress", value); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	return nil
+}
+
+func setSize(name string) func(c *prop.Change) *dbus.Error {
+	return func(c *prop.Change) *dbus.Error {
+		size, ok := c.Value.(string)
+		if !ok {
+			return dbus.MakeFailedError(fmt.Errorf("invalid type for %s", name))
+		}
+
+		if err := validateSize(name, size); err != nil {
+			return dbus.MakeFailedError(err)
+		}
+		if err := setOption(name, size); err != nil {
+			return dbus.MakeFailedError(err)
+		}
+
+		return nil
+	}
+}
+
+// ListCoredumps returns the core dumps stored by systemd-coredump, newest
+// first.
+func (d coredump) ListCoredumps() ([]dumpInfo, *dbus.Error) {
+	dumps, err := listDumps(coredumpDir)
+	if err != nil {
+		return nil, dbus.MakeFailedError(fmt.Errorf("failed to list core dumps: %w", err))
+	}
+	return dumps, nil
+}
+
+// ExportCoredump copies a core dump as listed by ListCoredumps into the
+// export directory of the agent, /mnt/data/os-agent/coredumps, and returns
+// the file name of the copy there. The dump is copied as stored, i.e.
+// compressed if its name has a compression suffix.
+func (d coredump) ExportCoredump(name string) (string, *dbus.Error) {
+	exported, err := exportDump(coredumpDir, name, exportDir)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+
+	logging.Info.Printf("Exported core dump %s to %s", name, exportDir)
+	return exported, nil
+}
+
+func InitializeDBus(conn *dbus.Conn) {
+	d := coredump{
+		conn: conn,
+	}
+
+	names := []string{"Storage", "Compress"}
+	options := map[string]*prop.Prop{
+		"Storage": {
+			Value:    getOption("Storage", "external"),
+			Writable: true,
+			Emit:     prop.EmitTrue,
+			Callback: setStorage,
+		},
+		"Compress": {
+			Value:    getCompress(),
+			Writable: true,
+			Emit:     prop.EmitTrue,
+			Callback: setCompress,
+		},
+	}
+	for name, option := range sizeOptions {
+		names = append(names, name)
+		options[name] = &prop.Prop{
+			Value:    getOption(name, option.defaultValue),
+			Writable: true,
+			Emit:     prop.EmitTrue,
+			Callback: setSize(name),
+		}
+	}
+	slices.Sort(names)
+
+	propsSpec := map[string]map[string]*prop.Prop{
+		ifaceName: options,
+	}
+
+	props, err := prop.Export(conn, objectPath, propsSpec)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+	d.props = props
+	files := []string{configFile.FilePath}
+	settings.Register(ifaceName, props, names, files, validate)
+
+	err = filehistory.ExportProperties(conn, objectPath, props, files)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	err = conn.Export(d, objectPath, ifaceName)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	node := &introspect.Node{
+		Name: objectPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       ifaceName,
+				Methods:    introspect.Methods(d),
+				Properties: props.Introspection(ifaceName),
+			},
+		},
+	}
+
+	err = conn.Export(introspect.NewIntrospectable(node), objectPath, "org.freedesktop.DBus.Introspectable")
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	logging.Info.Printf("Exposing object %s with interface %s ...", objectPath, ifaceName)
+}
@@ -0,0 +1,185 @@
+package coredump
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := map[string]any{
+		"Storage":         "external",
+		"Compress":        false,
+		"ProcessSizeMax":  "2G",
+		"ExternalSizeMax": "infinity",
+		"MaxUse":          "10%",
+		"KeepFree":        "1073741824",
+	}
+	if err := validate(valid); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	invalid := []map[string]any{
+		{"Storage": "disk"},
+		{"ProcessSizeMax": "10%"},
+		{"ExternalSizeMax": "2 G"},
+		{"MaxUse": "1000%"},
+		{"KeepFree": "1G\nStorage=none"},
+	}
+	for _, changes := range invalid {
+		if err := validate(changes); err == nil {
+			t.Errorf("validate(%v) expected an error", changes)
+		}
+	}
+}
+
+func TestGetOption(t *testing.T) {
+	root := t.TempDir()
+	etc, usr := filepath.Join(root, "etc"), filepath.Join(root, "usr")
+	previous := configRoots
+	configRoots = []string{etc, usr}
+	t.Cleanup(func() { configRoots = previous })
+
+	for path, content := range map[string]string{
+		filepath.Join(usr, "coredump.conf"):                       "[Coredump]\nStorage=journal\nMaxUse=5%\nKeepFree=1G\n",
+		filepath.Join(usr, "coredump.conf.d", "10-vendor.conf"):   "[Coredump]\nStorage=none\nCompress=no\n",
+		filepath.Join(etc, "coredump.conf.d", "50-local.conf"):    "[Coredump]\nMaxUse=20%\n",
+		filepath.Join(etc, "coredump.conf.d", "90-os-agent.conf"): "[Coredump]\nKeepFree=\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Drop-ins of any directory apply on top of coredump.conf, an empty
+	// assignment restores the default
+	for name, expected := range map[string]string{"MaxUse": "20%", "KeepFree": "15%", "ProcessSizeMax": "32G"} {
+		if value := getOption(name, sizeOptions[name].defaultValue); value != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, value)
+		}
+	}
+	if value := getOption("Storage", "external"); value != "none" {
+		t.Errorf("Storage: expected %q, got %q", "none", value)
+	}
+	if getCompress() {
+		t.Error("expected compression to be disabled by the vendor drop-in")
+	}
+}
+
+func TestParseDumpName(t *testing.T) {
+	info, ok := parseDumpName(`core.python3\x2e12.0.5f3b2c8e4a7d4f0e9b1c2d3e4f5a6b7c.4242.1697040000123456.zst`)
+	if !ok {
+		t.Fatal("expected a valid name")
+	}
+	if info.Executable != "python3.12" || info.PID != 4242 || info.Timestamp != 1697040000 {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	for _, name := range []string{"core.python3", "notcore.a.0.b.1.2", "core.a.0.b.pid.2", "core.a.0.b.1.time"} {
+		if _, ok := parseDumpName(name); ok {
+			t.Errorf("parseDumpName(%q) expected to fail", name)
+		}
+	}
+}
+
+func TestListDumps(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"core.old.0.b.1.1000000000000000.zst",
+		"core.new.0.b.2.1700000000000000",
+		"unrelated.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("core"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dumps, err := listDumps(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dumps) != 2 || dumps[0].Executable != "new" || dumps[1].Executable != "old" || dumps[0].Size != 4 {
+		t.Errorf("unexpected dumps %+v", dumps)
+	}
+
+	dumps, err = listDumps(filepath.Join(dir, "missing"))
+	if err != nil || len(dumps) != 0 {
+		t.Errorf("expected no dumps for a missing directory, got %v, %v", dumps, err)
+	}
+}
+
+func TestExportDump(t *testing.T) {
+	dir := t.TempDir()
+	export := filepath.Join(t.TempDir(), "coredumps")
+	name := "core.test.0.b.1.1700000000000000.zst"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("core"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := exportDump(dir, name, export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported != name {
+		t.Errorf("expected the file name %s, got %s", name, exported)
+	}
+	if content, _ := os.ReadFile(filepath.Join(export, exported)); string(content) != "core" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	// Existing copies are not overwritten
+	if _, err := exportDump(dir, name, export); err == nil {
+		t.Error("expected an error for an existing copy")
+	}
+
+	for _, invalid := range []string{"../core.test.0.b.1.1700000000000000.zst", "passwd", "core.missing.0.b.1.1700000000000000"} {
+		if _, err := exportDump(dir, invalid, t.TempDir()); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestExportDumpSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(t.TempDir(), "shadow")
+	if err := os.WriteFile(secret, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A symlinked dump is not followed
+	linked := "core.test.0.b.1.1700000000000000"
+	if err := os.Symlink(secret, filepath.Join(dir, linked)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exportDump(dir, linked, t.TempDir()); err == nil {
+		t.Error("expected an error for a symlinked core dump")
+	}
+
+	// Neither is a symlink planted in the export directory
+	name := "core.test.0.b.2.1700000000000000"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("core"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	export := t.TempDir()
+	if err := os.Symlink(secret, filepath.Join(export, name)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exportDump(dir, name, export); err == nil {
+		t.Error("expected an error for a symlink in the export directory")
+	}
+	if content, _ := os.ReadFile(secret); string(content) != "secret" {
+		t.Errorf("symlink target was overwritten: %q", content)
+	}
+
+	// Or the export directory itself being a symlink
+	exportLink := filepath.Join(t.TempDir(), "coredumps")
+	if err := os.Symlink(t.TempDir(), exportLink); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exportDump(dir, name, exportLink); err == nil {
+		t.Error("expected an error for a symlinked export directory")
+	}
+}
@@ -0,0 +1,171 @@
+package coredump
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	coredumpDir = "/var/lib/systemd/coredump"
+	// exportDir is owned by the agent, core dumps are only exported there.
+	exportDir = "/mnt/data/os-agent/coredumps"
+)
+
+var escapeRegexp = regexp.MustCompile(`\\x([0-9a-f]{2})`)
+
+// dumpInfo is the (ssuutt) description of a stored core dump.
+type dumpInfo struct {
+	Name       string
+	Executable string
+	PID        uint32
+	Signal     uint32
+	Size       uint64
+	// Timestamp of the crash in seconds since the epoch
+	Timestamp uint64
+}
+
+// unescape reverts the \xNN escaping systemd-coredump applies to the
+// command name in file names.
+func unescape(value string) string {
+	return escapeRegexp.ReplaceAllStringFunc(value, func(m string) string {
+		b, _ := strconv.ParseUint(m[2:], 16, 8)
+		return string(rune(b))
+	})
+}
+
+// parseDumpName extracts the fields of a core dump file name of the form
+// core.COMM.UID.BOOTID.PID.USEC[.COMPRESSION].
+func parseDumpName(name string) (dumpInfo, bool) {
+	parts := strings.Split(name, ".")
+	if len(parts) < 6 || parts[0] != "core" {
+		return dumpInfo{}, false
+	}
+
+	pid, err := strconv.ParseUint(parts[4], 10, 32)
+	if err != nil {
+		return dumpInfo{}, false
+	}
+	usec, err := strconv.ParseUint(parts[5], 10, 64)
+	if err != nil {
+		return dumpInfo{}, false
+	}
+
+	return dumpInfo{
+		Name:       name,
+		Executable: unescape(parts[1]),
+		PID:        uint32(pid), //nolint:gosec
+		Timestamp:  usec / 1000000,
+	}, true
+}
+
+func getXattr(path string, name string) (string, bool) {
+	buf := make([]byte, 4096)
+	n, err := syscall.Getxattr(path, "user.coredump."+name, buf)
+	if err != nil || n <= 0 {
+		return "", false
+	}
+	return strings.TrimRight(string(buf[:n]), "\x00"), true
+}
+
+// readDump describes a core dump, preferring the metadata systemd-coredump
+// stores in extended attributes over the abbreviated command name of the
+// file name.
+func readDump(dir string, entry os.DirEntry) (dumpInfo, bool) {
+	info, ok := parseDumpName(entry.Name())
+	if !ok || !entry.Type().IsRegular() {
+		return dumpInfo{}, false
+	}
+
+	path := filepath.Join(dir, entry.Name())
+	if exe, ok := getXattr(path, "exe"); ok {
+		info.Executable = exe
+	}
+	if value, ok := getXattr(path, "signal"); ok {
+		if signal, err := strconv.ParseUint(value, 10, 32); err == nil {
+			info.Signal = uint32(signal) //nolint:gosec
+		}
+	}
+	if fileInfo, err := entry.Info(); err == nil {
+		info.Size = uint64(fileInfo.Size()) //nolint:gosec
+	}
+
+	return info, true
+}
+
+func listDumps(dir string) ([]dumpInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []dumpInfo{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	dumps := []dumpInfo{}
+	for _, entry := range entries {
+		if info, ok := readDump(dir, entry); ok {
+			dumps = append(dumps, info)
+		}
+	}
+
+	sort.SliceStable(dumps, func(i, j int) bool {
+		return dumps[i].Timestamp > dumps[j].Timestamp
+	})
+
+	return dumps, nil
+}
+
+// exportDump copies the named core dump of dir into exportDir and returns
+// the name of the copy. Only names of stored dumps are accepted, symlinks are
+// neither followed in dir nor in exportDir and existing copies are never
+// overwritten.
+func exportDump(dir string, name string, exportDir string) (string, error) {
+	if _, ok := parseDumpName(name); !ok || name != filepath.Base(name) {
+		return "", fmt.Errorf("invalid core dump name %q", name)
+	}
+
+	src, err := os.OpenFile(filepath.Join(dir, name), os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("core dump %s not found", name)
+	} else if errors.Is(err, syscall.ELOOP) {
+		return "", fmt.Errorf("core dump %s is a symlink", name)
+	} else if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	if info, err := src.Stat(); err != nil {
+		return "", err
+	} else if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("core dump %s is not a regular file", name)
+	}
+
+	if err := os.MkdirAll(exportDir, 0o750); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", exportDir, err)
+	}
+	if info, err := os.Lstat(exportDir); err != nil {
+		return "", err
+	} else if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", exportDir)
+	}
+
+	target := filepath.Join(exportDir, name)
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", target, err)
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(target)
+		return "", fmt.Errorf("failed to copy core dump: %w", err)
+	}
+
+	return name, dst.Close()
+}
@@ -0,0 +1,120 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/home-assistant/os-agent/utils/filehistory"
+	logging "github.com/home-assistant/os-agent/utils/log"
+)
+
+const (
+	objectPath = "/io/hass/os/Config/History"
+	ifaceName  = "io.hass.os.Config.History"
+	storePath  = "/var/lib/os-agent/history"
+)
+
+type history struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+}
+
+// change is the (sutsb) representation of a recorded change.
+type change struct {
+	File     string
+	Revision uint32
+	Time     uint64
+	Caller   string
+	Existed  bool
+}
+
+// ListChanges returns all recorded changes of managed files, oldest first.
+// Rolling back a change restores the content the file had before it.
+func (d history) ListChanges() ([]change, *dbus.Error) {
+	entries, err := filehistory.List()
+	if err != nil {
+		return nil, dbus.MakeFailedError(fmt.Errorf("failed to read history: %w", err))
+	}
+
+	changes := make([]change, 0, len(entries))
+	for _, e := range entries {
+		changes = append(changes, change{
+			File:     e.File,
+			Revision: e.Revision,
+			Time:     uint64(e.Time), //nolint:gosec
+			Caller:   e.Caller,
+			Existed:  e.Existed,
+		})
+	}
+
+	return changes, nil
+}
+
+// Rollback restores file to the content it had before the given change. The
+// new content is picked up once the affected service is restarted or the
+// setting is re-read.
+func (d history) Rollback(file string, revision uint32) *dbus.Error {
+	if err := filehistory.Rollback(file, revision); err != nil {
+		if errors.Is(err, filehistory.ErrUnknownRevision) || errors.Is(err, filehistory.ErrUnmanagedFile) {
+			return dbus.MakeFailedError(err)
+		}
+		return dbus.MakeFailedError(fmt.Errorf("failed to roll back %s: %w", file, err))
+	}
+
+	logging.Info.Printf("Rolled back %s to the version before revision %d", file, revision)
+	return nil
+}
+
+func InitializeDBus(conn *dbus.Conn) {
+	filehistory.Enable(storePath)
+
+	d := history{
+		conn: conn,
+	}
+
+	propsSpec := map[string]map[string]*prop.Prop{
+		ifaceName: {
+			"MaxRevisions": {
+				Value:    uint32(filehistory.MaxRevisions),
+				Writable: false,
+				Emit:     prop.EmitInvalidates,
+				Callback: nil,
+			},
+		},
+	}
+
+	props, err := prop.Export(conn, objectPath, propsSpec)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+	d.props = props
+
+	err = conn.Export(d, objectPath, ifaceName)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	node := &introspect.Node{
+		Name: objectPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       ifaceName,
+				Methods:    introspect.Methods(d),
+				Properties: props.Introspection(ifaceName),
+			},
+		},
+	}
+
+	err = conn.Export(introspect.NewIntrospectable(node), objectPath, "org.freedesktop.DBus.Introspectable")
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	logging.Info.Printf("Exposing object %s with interface %s ...", objectPath, ifaceName)
+}
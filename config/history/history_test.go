@@ -0,0 +1,102 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/home-assistant/os-agent/utils/filehistory"
+)
+
+func setup(t *testing.T) string {
+	t.Helper()
+	filehistory.Enable(t.TempDir())
+	t.Cleanup(func() { filehistory.Enable("") })
+	return t.TempDir()
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	err := filehistory.Track(":1.42", []string{path}, func() error {
+		return os.WriteFile(path, []byte(content), 0o600)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListChanges(t *testing.T) {
+	dir := setup(t)
+	first := filepath.Join(dir, "first.conf")
+	second := filepath.Join(dir, "second.conf")
+
+	writeFile(t, first, "a\n")
+	writeFile(t, first, "b\n")
+	writeFile(t, second, "c\n")
+
+	changes, dbusErr := history{}.ListChanges()
+	if dbusErr != nil {
+		t.Fatal(dbusErr)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %+v", changes)
+	}
+
+	revisions := map[string][]uint32{}
+	for _, c := range changes {
+		revisions[c.File] = append(revisions[c.File], c.Revision)
+		if c.Caller != ":1.42" || c.Time == 0 {
+			t.Errorf("unexpected change %+v", c)
+		}
+	}
+	if len(revisions[first]) != 2 || revisions[first][0] != 1 || revisions[first][1] != 2 || len(revisions[second]) != 1 {
+		t.Errorf("unexpected revisions %v", revisions)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	path := filepath.Join(setup(t), "test.conf")
+
+	writeFile(t, path, "first\n")
+	writeFile(t, path, "second\n")
+
+	if dbusErr := (history{}).Rollback(path, 2); dbusErr != nil {
+		t.Fatal(dbusErr)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "first\n" {
+		t.Errorf("expected %q after rollback, got %q", "first\n", content)
+	}
+
+	changes, _ := history{}.ListChanges()
+	if len(changes) != 3 || changes[2].Caller != "rollback" {
+		t.Errorf("expected the rollback to be recorded, got %+v", changes)
+	}
+}
+
+func TestRollbackRejectsUnknown(t *testing.T) {
+	dir := setup(t)
+	path := filepath.Join(dir, "test.conf")
+	writeFile(t, path, "first\n")
+
+	// Files which were never recorded can't be written through a rollback
+	other := filepath.Join(dir, "other.conf")
+	if err := os.WriteFile(other, []byte("keep\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{other, "/etc/shadow", "../test.conf", ""} {
+		if dbusErr := (history{}).Rollback(file, 1); dbusErr == nil {
+			t.Errorf("expected an error rolling back %q", file)
+		}
+	}
+	if content, _ := os.ReadFile(other); string(content) != "keep\n" {
+		t.Errorf("unrecorded file was modified: %q", content)
+	}
+
+	if dbusErr := (history{}).Rollback(path, 7); dbusErr == nil {
+		t.Errorf("expected an error for an unknown revision")
+	}
+}
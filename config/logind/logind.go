@@ -0,0 +1,202 @@
+package logind
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/home-assistant/os-agent/utils/filehistory"
+	"github.com/home-assistant/os-agent/utils/inifile"
+	logging "github.com/home-assistant/os-agent/utils/log"
+	"github.com/home-assistant/os-agent/utils/settings"
+	"github.com/home-assistant/os-agent/utils/systemd"
+)
+
+const (
+	objectPath      = "/io/hass/os/Config/Logind"
+	ifaceName       = "io.hass.os.Config.Logind"
+	dropInPath      = "/etc/systemd/logind.conf.d/90-os-agent.conf"
+	logindUnit      = "systemd-logind.service"
+	login1Name      = "org.freedesktop.login1"
+	login1Path      = "/org/freedesktop/login1"
+	login1Iface     = "org.freedesktop.login1.Manager"
+	propertiesIface = "org.freedesktop.DBus.Properties"
+	methodTimeout   = 5 * time.Second
+)
+
+var (
+	configFile = inifile.IniFile{FilePath: dropInPath}
+	// dropInMu serializes modifications of the drop-in file.
+	dropInMu sync.Mutex
+
+	// actions lists the values accepted by the key handling and idle options.
+	actions = []string{"ignore", "poweroff", "reboot", "halt", "kexec", "suspend", "hibernate", "hybrid-sleep", "suspend-then-hibernate", "lock"}
+
+	// actionOptions are the managed options along with the logind default,
+	// used if logind can't be asked for the value in effect.
+	actionOptions = map[string]string{
+		"HandlePowerKey":          "poweroff",
+		"HandlePowerKeyLongPress": "ignore",
+		"HandleRebootKey":         "reboot",
+		"IdleAction":              "ignore",
+	}
+)
+
+type logind struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+}
+
+func validateAction(name string, value string) error {
+	if !slices.Contains(actions, value) {
+		return fmt.Errorf("invalid value %q for %s (must be one of %s)", value, name, strings.Join(actions, ", "))
+	}
+	return nil
+}
+
+// validate checks new values for the writable properties, used to validate
+// all changes of a transaction before any of them is written.
+func validate(changes map[string]any) error {
+	for name, value := range changes {
+		if err := validateAction(name, value.(string)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getProperty(conn *dbus.Conn, name string, value any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), methodTimeout)
+	defer cancel()
+
+	return conn.Object(login1Name, login1Path).CallWithContext(ctx, propertiesIface+".Get", 0, login1Iface, name).Store(value)
+}
+
+// getAction returns the configured value of an option, or the one currently
+// in effect according to current if the agent hasn't set it. The logind
+// default is used if neither is known.
+func getAction(name string, current func(name string) (string, error)) string {
+	if value, ok, err := configFile.Get("Login", name); err == nil && ok {
+		return value
+	}
+
+	value, err := current(name)
+	if err != nil {
+		logging.Warning.Printf("Failed to read %s from logind: %s", name, err)
+		return actionOptions[name]
+	}
+	return value
+}
+
+func setAction(name string) func(c *prop.Change) *dbus.Error {
+	return func(c *prop.Change) *dbus.Error {
+		value, ok := c.Value.(string)
+		if !ok {
+			return dbus.MakeFailedError(fmt.Errorf("invalid type for %s", name))
+		}
+
+		if err := validateAction(name, value); err != nil {
+			return dbus.MakeFailedError(err)
+		}
+
+		dropInMu.Lock()
+		defer dropInMu.Unlock()
+
+		if err := os.MkdirAll(filepath.Dir(configFile.FilePath), 0o755); err != nil { //nolint:gosec
+			return dbus.MakeFailedError(fmt.Errorf("failed to create %s: %w", filepath.Dir(configFile.FilePath), err))
+		}
+		if err := configFile.Set("Login", name, value); err != nil {
+			return dbus.MakeFailedError(fmt.Errorf("failed to set %s: %w", name, err))
+		}
+
+		logging.Info.Printf("Set logind %s to %s", name, value)
+		return nil
+	}
+}
+
+// Apply restarts logind so changed settings are used right away. Sessions
+// are kept across the restart.
+func (d logind) Apply() *dbus.Error {
+	if err := systemd.RestartUnit(logindUnit); err != nil {
+		return dbus.MakeFailedError(fmt.Errorf("failed to restart %s: %w", logindUnit, err))
+	}
+
+	logging.Info.Printf("Restarted %s to apply new configuration", logindUnit)
+	return nil
+}
+
+func InitializeDBus(conn *dbus.Conn) {
+	d := logind{
+		conn: conn,
+	}
+
+	current := func(name string) (string, error) {
+		var value string
+		err := getProperty(conn, name, &value)
+		return value, err
+	}
+
+	names := make([]string, 0, len(actionOptions))
+	options := map[string]*prop.Prop{}
+	for name := range actionOptions {
+		names = append(names, name)
+		options[name] = &prop.Prop{
+			Value:    getAction(name, current),
+			Writable: true,
+			Emit:     prop.EmitTrue,
+			Callback: setAction(name),
+		}
+	}
+	slices.Sort(names)
+
+	propsSpec := map[string]map[string]*prop.Prop{
+		ifaceName: options,
+	}
+
+	props, err := prop.Export(conn, objectPath, propsSpec)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+	d.props = props
+	files := []string{configFile.FilePath}
+	settings.Register(ifaceName, props, names, files, validate)
+
+	err = filehistory.ExportProperties(conn, objectPath, props, files)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	err = conn.Export(d, objectPath, ifaceName)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	node := &introspect.Node{
+		Name: objectPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       ifaceName,
+				Methods:    introspect.Methods(d),
+				Properties: props.Introspection(ifaceName),
+			},
+		},
+	}
+
+	err = conn.Export(introspect.NewIntrospectable(node), objectPath, "org.freedesktop.DBus.Introspectable")
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	logging.Info.Printf("Exposing object %s with interface %s ...", objectPath, ifaceName)
+}
@@ -0,0 +1,129 @@
+package logind
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/home-assistant/os-agent/utils/inifile"
+)
+
+func useDropIn(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "logind.conf.d", "90-os-agent.conf")
+	if content != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+	}
+
+	previous := configFile
+	configFile = inifile.IniFile{FilePath: path}
+	t.Cleanup(func() { configFile = previous })
+	return path
+}
+
+func readDropIn(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestValidate(t *testing.T) {
+	if err := validate(map[string]any{"HandlePowerKey": "suspend", "IdleAction": "ignore"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	for _, value := range []string{"", "shutdown", "poweroff\nHandleLidSwitch=ignore", "Poweroff"} {
+		if err := validate(map[string]any{"HandlePowerKey": value}); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestGetAction(t *testing.T) {
+	useDropIn(t, "[Login]\nHandlePowerKey=suspend\n#IdleAction=lock\n")
+
+	logindValues := func(name string) (string, error) {
+		return map[string]string{"HandlePowerKey": "poweroff", "IdleAction": "ignore", "HandleRebootKey": "halt"}[name], nil
+	}
+	failing := func(name string) (string, error) {
+		return "", errors.New("logind not available")
+	}
+
+	cases := []struct {
+		name    string
+		current func(name string) (string, error)
+		want    string
+	}{
+		// The drop-in takes precedence over the value in effect
+		{"HandlePowerKey", logindValues, "suspend"},
+		{"HandlePowerKey", failing, "suspend"},
+		// Commented-out and missing options are read from logind
+		{"IdleAction", logindValues, "ignore"},
+		{"HandleRebootKey", logindValues, "halt"},
+		// The logind default is used if logind can't be asked
+		{"HandleRebootKey", failing, "reboot"},
+		{"HandlePowerKeyLongPress", failing, "ignore"},
+	}
+	for _, c := range cases {
+		if got := getAction(c.name, c.current); got != c.want {
+			t.Errorf("getAction(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSetAction(t *testing.T) {
+	path := useDropIn(t, "")
+
+	for _, change := range [][2]string{
+		{"HandlePowerKey", "suspend"},
+		{"IdleAction", "lock"},
+		{"HandlePowerKey", "ignore"},
+	} {
+		if err := setAction(change[0])(&prop.Change{Name: change[0], Value: change[1]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "[Login]\nHandlePowerKey=ignore\nIdleAction=lock\n"
+	if got := readDropIn(t, path); got != want {
+		t.Errorf("unexpected drop-in %q, want %q", got, want)
+	}
+	if got := getAction("IdleAction", nil); got != "lock" {
+		t.Errorf("expected the written value to be effective, got %q", got)
+	}
+
+	// Invalid values leave the drop-in untouched
+	if err := setAction("HandlePowerKey")(&prop.Change{Name: "HandlePowerKey", Value: "poweroff\nIdleAction=ignore"}); err == nil {
+		t.Errorf("expected an error for an invalid value")
+	}
+	if err := setAction("HandlePowerKey")(&prop.Change{Name: "HandlePowerKey", Value: true}); err == nil {
+		t.Errorf("expected an error for an invalid type")
+	}
+	if got := readDropIn(t, path); got != want {
+		t.Errorf("drop-in changed by invalid values: %q", got)
+	}
+}
+
+func TestSetActionKeepsManualChanges(t *testing.T) {
+	path := useDropIn(t, "# Local overrides\n[Login]\n# Power button suspends\nHandlePowerKey = suspend\nHandleLidSwitch=ignore\n")
+
+	if err := setAction("HandlePowerKey")(&prop.Change{Name: "HandlePowerKey", Value: "poweroff"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "# Local overrides\n[Login]\n# Power button suspends\nHandlePowerKey = poweroff\nHandleLidSwitch=ignore\n"
+	if got := readDropIn(t, path); got != want {
+		t.Errorf("unexpected drop-in %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,397 @@
+package resolved
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/home-assistant/os-agent/utils/filehistory"
+	"github.com/home-assistant/os-agent/utils/inifile"
+	logging "github.com/home-assistant/os-agent/utils/log"
+	"github.com/home-assistant/os-agent/utils/settings"
+	"github.com/home-assistant/os-agent/utils/systemd"
+)
+
+const (
+	objectPath      = "/io/hass/os/Config/Resolved"
+	ifaceName       = "io.hass.os.Config.Resolved"
+	dropInPath      = "/etc/systemd/resolved.conf.d/90-os-agent.conf"
+	resolvedUnit    = "systemd-resolved.service"
+	resolve1Name    = "org.freedesktop.resolve1"
+	resolve1Path    = "/org/freedesktop/resolve1"
+	resolve1Iface   = "org.freedesktop.resolve1.Manager"
+	propertiesIface = "org.freedesktop.DBus.Properties"
+	methodTimeout   = 5 * time.Second
+)
+
+var (
+	configFile = inifile.IniFile{FilePath: dropInPath}
+	// dropInMu serializes modifications of the drop-in file.
+	dropInMu sync.Mutex
+
+	// modeOptions lists the accepted values of the mode settings.
+	modeOptions = map[string][]string{
+		"DNSSEC":       {"yes", "no", "allow-downgrade"},
+		"DNSOverTLS":   {"yes", "no", "opportunistic"},
+		"MulticastDNS": {"yes", "no", "resolve"},
+		"LLMNR":        {"yes", "no", "resolve"},
+	}
+)
+
+type resolved struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+}
+
+// dnsServer mirrors the (iiay) server entries of resolved.
+type dnsServer struct {
+	IfIndex int32
+	Family  int32
+	Address []byte
+}
+
+func formatServer(server dnsServer) string {
+	if len(server.Address) != net.IPv4len && len(server.Address) != net.IPv6len {
+		return ""
+	}
+	return net.IP(server.Address).String()
+}
+
+func getProperty(conn *dbus.Conn, name string, value any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), methodTimeout)
+	defer cancel()
+
+	return conn.Object(resolve1Name, resolve1Path).CallWithContext(ctx, propertiesIface+".Get", 0, resolve1Iface, name).Store(value)
+}
+
+func getServers(conn *dbus.Conn, name string) []string {
+	servers := []string{}
+
+	var entries []dnsServer
+	if err := getProperty(conn, name, &entries); err != nil {
+		logging.Warning.Printf("Failed to read %s from resolved: %s", name, err)
+		return servers
+	}
+
+	for _, entry := range entries {
+		if address := formatServer(entry); address != "" {
+			servers = append(servers, address)
+		}
+	}
+
+	return servers
+}
+
+func getCurrentServer(conn *dbus.Conn) string {
+	var server dnsServer
+	if err := getProperty(conn, "CurrentDNSServer", &server); err != nil {
+		return ""
+	}
+	return formatServer(server)
+}
+
+// validateFallbackDNS checks that all entries are IP addresses, optionally
+// followed by the server name used for DNS-over-TLS (e.g. "1.1.1.1#one.one.one.one").
+func validateFallbackDNS(servers []string) error {
+	for _, server := range servers {
+		address, name, _ := strings.Cut(server, "#")
+		if net.ParseIP(address) == nil {
+			return fmt.Errorf("invalid DNS server %q", server)
+		}
+		if strings.ContainsAny(name, " \t\n#") {
+			return fmt.Errorf("invalid DNS server name in %q", server)
+		}
+	}
+
+	return nil
+}
+
+func validateMode(name string, value string) error {
+	if !slices.Contains(modeOptions[name], value) {
+		return fmt.Errorf("invalid value %q for %s (must be one of %s)", value, name, strings.Join(modeOptions[name], ", "))
+	}
+	return nil
+}
+
+// validate checks new values for the writable properties, used to validate
+// all changes of a transaction before any of them is written.
+func validate(changes map[string]any) error {
+	for name, value := range changes {
+		var err error
+		if name == "FallbackDNS" {
+			err = validateFallbackDNS(value.([]string))
+		} else {
+			err = validateMode(name, value.(string))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getOption(name string) (string, bool) {
+	value, ok, err := configFile.Get("Resolve", name)
+	if err != nil {
+		return "", false
+	}
+	return value, ok
+}
+
+func setOption(name string, value string) error {
+	dropInMu.Lock()
+	defer dropInMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(configFile.FilePath), 0o755); err != nil { //nolint:gosec
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(configFile.FilePath), err)
+	}
+	if err := configFile.Set("Resolve", name, value); err != nil {
+		return fmt.Errorf("failed to set %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// setListOption writes a list setting preceded by an empty assignment, so
+// the entries replace those of resolved.conf instead of extending them.
+func setListOption(name string, values []string) error {
+	dropInMu.Lock()
+	defer dropInMu.Unlock()
+
+	assignments := []string{""}
+	if len(values) > 0 {
+		assignments = append(assignments, strings.Join(values, " "))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configFile.FilePath), 0o755); err != nil { //nolint:gosec
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(configFile.FilePath), err)
+	}
+	if err := configFile.SetAll("Resolve", name, assignments); err != nil {
+		return fmt.Errorf("failed to set %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// getFallbackDNS returns the configured fallback servers, or the ones
+// currently in effect if the agent hasn't set them.
+func getFallbackDNS(conn *dbus.Conn) []string {
+	values, err := configFile.GetAll("Resolve", "FallbackDNS")
+	if err != nil || len(values) == 0 {
+		return getServers(conn, "FallbackDNS")
+	}
+
+	// An empty assignment resets the list
+	servers := []string{}
+	for _, value := range values {
+		if value == "" {
+			servers = []string{}
+		}
+		servers = append(servers, strings.Fields(value)...)
+	}
+
+	return servers
+}
+
+func setFallbackDNS(c *prop.Change) *dbus.Error {
+	servers, ok := c.Value.([]string)
+	if !ok {
+		return dbus.MakeFailedError(fmt.Errorf("invalid type for FallbackDNS"))
+	}
+
+	if err := validateFallbackDNS(servers); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	if err := setListOption("FallbackDNS", servers); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	logging.Info.Printf("Set resolved FallbackDNS to %s", strings.Join(servers, " "))
+	return nil
+}
+
+// getMode returns the configured value of a mode setting, or the one
+// currently in effect if the agent hasn't set it.
+func getMode(conn *dbus.Conn, name string) string {
+	if value, ok := getOption(name); ok {
+		return value
+	}
+
+	var value string
+	if err := getProperty(conn, name, &value); err != nil {
+		logging.Warning.Printf("Failed to read %s from resolved: %s", name, err)
+	}
+	return value
+}
+
+func setMode(name string) func(c *prop.Change) *dbus.Error {
+	return func(c *prop.Change) *dbus.Error {
+		value, ok := c.Value.(string)
+		if !ok {
+			return dbus.MakeFailedError(fmt.Errorf("invalid type for %s", name))
+		}
+
+		if err := validateMode(name, value); err != nil {
+			return dbus.MakeFailedError(err)
+		}
+
+		if err := setOption(name, value); err != nil {
+			return dbus.MakeFailedError(err)
+		}
+
+		logging.Info.Printf("Set resolved %s to %s", name, value)
+		return nil
+	}
+}
+
+func (d resolved) updateServers() {
+	current := getCurrentServer(d.conn)
+	if d.props.GetMust(ifaceName, "CurrentDNSServer").(string) != current {
+		d.props.SetMust(ifaceName, "CurrentDNSServer", current)
+	}
+
+	servers := getServers(d.conn, "DNS")
+	if strings.Join(d.props.GetMust(ifaceName, "DNSServers").([]string), " ") != strings.Join(servers, " ") {
+		d.props.SetMust(ifaceName, "DNSServers", servers)
+	}
+}
+
+// watchServers refreshes the effective servers whenever resolved reports a
+// change of its properties.
+func (d resolved) watchServers() {
+	err := d.conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(resolve1Path),
+		dbus.WithMatchInterface(propertiesIface),
+		dbus.WithMatchMember("PropertiesChanged"),
+	)
+	if err != nil {
+		logging.Error.Printf("Failed to watch resolved servers: %s", err)
+		return
+	}
+
+	signals := make(chan *dbus.Signal, 10)
+	d.conn.Signal(signals)
+
+	go func() {
+		for signal := range signals {
+			if signal.Path != resolve1Path || signal.Name != propertiesIface+".PropertiesChanged" {
+				continue
+			}
+			d.updateServers()
+		}
+	}()
+}
+
+// Apply restarts resolved so changed settings are used right away.
+func (d resolved) Apply() *dbus.Error {
+	if err := systemd.RestartUnit(resolvedUnit); err != nil {
+		return dbus.MakeFailedError(fmt.Errorf("failed to restart %s: %w", resolvedUnit, err))
+	}
+
+	logging.Info.Printf("Restarted %s to apply new configuration", resolvedUnit)
+	return nil
+}
+
+func InitializeDBus(conn *dbus.Conn) {
+	d := resolved{
+		conn: conn,
+	}
+
+	propsSpec := map[string]map[string]*prop.Prop{
+		ifaceName: {
+			"FallbackDNS": {
+				Value:    getFallbackDNS(conn),
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: setFallbackDNS,
+			},
+			"DNSSEC": {
+				Value:    getMode(conn, "DNSSEC"),
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: setMode("DNSSEC"),
+			},
+			"DNSOverTLS": {
+				Value:    getMode(conn, "DNSOverTLS"),
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: setMode("DNSOverTLS"),
+			},
+			"MulticastDNS": {
+				Value:    getMode(conn, "MulticastDNS"),
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: setMode("MulticastDNS"),
+			},
+			"LLMNR": {
+				Value:    getMode(conn, "LLMNR"),
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: setMode("LLMNR"),
+			},
+			"CurrentDNSServer": {
+				Value:    getCurrentServer(conn),
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"DNSServers": {
+				Value:    getServers(conn, "DNS"),
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+		},
+	}
+
+	props, err := prop.Export(conn, objectPath, propsSpec)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+	d.props = props
+	files := []string{configFile.FilePath}
+	settings.Register(ifaceName, props, []string{"FallbackDNS", "DNSSEC", "DNSOverTLS", "MulticastDNS", "LLMNR"}, files, validate)
+
+	err = filehistory.ExportProperties(conn, objectPath, props, files)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	err = conn.Export(d, objectPath, ifaceName)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	node := &introspect.Node{
+		Name: objectPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       ifaceName,
+				Methods:    introspect.Methods(d),
+				Properties: props.Introspection(ifaceName),
+			},
+		},
+	}
+
+	err = conn.Export(introspect.NewIntrospectable(node), objectPath, "org.freedesktop.DBus.Introspectable")
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	logging.Info.Printf("Exposing object %s with interface %s ...", objectPath, ifaceName)
+
+	d.watchServers()
+}
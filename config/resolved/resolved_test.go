@@ -0,0 +1,132 @@
+package resolved
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/home-assistant/os-agent/utils/inifile"
+)
+
+func useDropIn(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "resolved.conf.d", "90-os-agent.conf")
+	if content != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+	}
+
+	previous := configFile
+	configFile = inifile.IniFile{FilePath: path}
+	t.Cleanup(func() { configFile = previous })
+	return path
+}
+
+func TestValidateFallbackDNS(t *testing.T) {
+	cases := []struct {
+		servers []string
+		valid   bool
+	}{
+		{[]string{}, true},
+		{[]string{"1.1.1.1"}, true},
+		{[]string{"1.1.1.1", "2606:4700:4700::1111"}, true},
+		{[]string{"1.1.1.1#one.one.one.one", "9.9.9.9#dns.quad9.net"}, true},
+		{[]string{"2606:4700:4700::1111#one.one.one.one"}, true},
+		{[]string{""}, false},
+		{[]string{"one.one.one.one"}, false},
+		{[]string{"1.1.1.256"}, false},
+		{[]string{"1.1.1.1 9.9.9.9"}, false},
+		{[]string{"1.1.1.1#one one"}, false},
+		{[]string{"1.1.1.1#one\tone"}, false},
+		{[]string{"1.1.1.1#one\nDNSSEC=no"}, false},
+		{[]string{"1.1.1.1#one#two"}, false},
+		{[]string{"1.1.1.1", "#one.one.one.one"}, false},
+	}
+	for _, c := range cases {
+		err := validateFallbackDNS(c.servers)
+		if c.valid && err != nil {
+			t.Errorf("validateFallbackDNS(%q) failed: %s", c.servers, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("validateFallbackDNS(%q) expected an error", c.servers)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := validate(map[string]any{"FallbackDNS": []string{"1.1.1.1"}, "DNSSEC": "allow-downgrade", "LLMNR": "resolve"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	invalid := []map[string]any{
+		{"FallbackDNS": []string{"one.one.one.one"}},
+		{"DNSSEC": "resolve"},
+		{"DNSOverTLS": "Yes"},
+		{"MulticastDNS": ""},
+		{"LLMNR": "no\nDNSSEC=no"},
+	}
+	for _, changes := range invalid {
+		if err := validate(changes); err == nil {
+			t.Errorf("validate(%v) expected an error", changes)
+		}
+	}
+}
+
+func TestGetFallbackDNS(t *testing.T) {
+	cases := []struct {
+		content string
+		want    []string
+	}{
+		{"[Resolve]\nFallbackDNS=1.1.1.1 9.9.9.9\n", []string{"1.1.1.1", "9.9.9.9"}},
+		{"[Resolve]\nFallbackDNS=1.1.1.1\nFallbackDNS=9.9.9.9\n", []string{"1.1.1.1", "9.9.9.9"}},
+		// An empty assignment clears the entries before it
+		{"[Resolve]\nFallbackDNS=1.1.1.1\nFallbackDNS=\nFallbackDNS=9.9.9.9  8.8.8.8\n", []string{"9.9.9.9", "8.8.8.8"}},
+		{"[Resolve]\nFallbackDNS=1.1.1.1\nFallbackDNS=\n", []string{}},
+		{"[Resolve]\nFallbackDNS=\n", []string{}},
+	}
+	for _, c := range cases {
+		useDropIn(t, c.content)
+		if got := getFallbackDNS(nil); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("getFallbackDNS() with %q = %q, want %q", c.content, got, c.want)
+		}
+	}
+}
+
+func TestSetListOption(t *testing.T) {
+	path := useDropIn(t, "")
+
+	if err := setListOption("FallbackDNS", []string{"1.1.1.1#one.one.one.one", "9.9.9.9"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := setOption("DNSSEC", "no"); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "FallbackDNS=\nFallbackDNS=1.1.1.1#one.one.one.one 9.9.9.9\n") {
+		t.Errorf("expected FallbackDNS to be reset before the entries:\n%s", content)
+	}
+	if got := getFallbackDNS(nil); !reflect.DeepEqual(got, []string{"1.1.1.1#one.one.one.one", "9.9.9.9"}) {
+		t.Errorf("unexpected servers %q", got)
+	}
+	if value, ok := getOption("DNSSEC"); !ok || value != "no" {
+		t.Errorf("unexpected DNSSEC %q, %t", value, ok)
+	}
+
+	// Clearing the list keeps only the empty assignment
+	if err := setListOption("FallbackDNS", []string{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := getFallbackDNS(nil); len(got) != 0 {
+		t.Errorf("expected no servers, got %q", got)
+	}
+}
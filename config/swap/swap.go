@@ -5,19 +5,43 @@ import (
 	"github.com/godbus/dbus/v5"
 	"github.com/godbus/dbus/v5/introspect"
 	"github.com/godbus/dbus/v5/prop"
+	"github.com/home-assistant/os-agent/utils/filehistory"
+	"github.com/home-assistant/os-agent/utils/filewatch"
 	"github.com/home-assistant/os-agent/utils/lineinfile"
 	logging "github.com/home-assistant/os-agent/utils/log"
+	"github.com/home-assistant/os-agent/utils/settings"
+	"github.com/home-assistant/os-agent/utils/systemd"
+	"maps"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 const (
-	objectPath     = "/io/hass/os/Config/Swap"
-	ifaceName      = "io.hass.os.Config.Swap"
-	swapPath       = "/etc/default/haos-swapfile"
-	swappinessPath = "/etc/sysctl.d/15-swappiness.conf"
+	objectPath           = "/io/hass/os/Config/Swap"
+	ifaceName            = "io.hass.os.Config.Swap"
+	swapPath             = "/etc/default/haos-swapfile"
+	swappinessPath       = "/etc/sysctl.d/15-swappiness.conf"
+	swapUnit             = "haos-swapfile.service"
+	kernelSwappinessPath = "/proc/sys/vm/swappiness"
+	procSwapsPath        = "/proc/swaps"
+	procMeminfoPath      = "/proc/meminfo"
+	sysBlockPath         = "/sys/block"
+	dataMount            = "/mnt/data"
+	swapFilePath         = "/mnt/data/swapfile"
+	// minDataFreeSpace is the space which must remain available on the data
+	// partition after the swapfile has been created.
+	minDataFreeSpace = 1 << 30
+	// maxSwapRAMRatio limits the swap size to a multiple of the system memory,
+	// anything beyond is never used in practice and only wastes disk space.
+	maxSwapRAMRatio      = 4
+	usageRefreshInterval = 30 * time.Second
 )
 
 var (
@@ -25,8 +49,16 @@ var (
 	optSwappiness    int
 	swapFileEditor   = lineinfile.LineInFile{FilePath: swapPath}
 	swappinessEditor = lineinfile.LineInFile{FilePath: swappinessPath}
+	// swapConfigPending is set when the swap configuration was written but
+	// the swapfile unit has not been restarted yet.
+	swapConfigPending bool
+	swapMu            sync.Mutex
 )
 
+// zramStatFields names the columns of /sys/block/zram*/mm_stat exposed in
+// the ZramStats property.
+var zramStatFields = []string{"orig_data_size", "compr_data_size", "mem_used_total", "mem_limit", "mem_used_max", "same_pages", "pages_compacted", "huge_pages"}
+
 type swap struct {
 	conn  *dbus.Conn
 	props *prop.Properties
@@ -35,7 +67,7 @@ type swap struct {
 // Read swappiness from kernel procfs. If it fails, log errors and return 60
 // as it's usual kernel default.
 func readKernelSwappiness() int {
-	content, err := os.ReadFile("/proc/sys/vm/swappiness")
+	content, err := os.ReadFile(kernelSwappinessPath)
 	if err != nil {
 		logging.Error.Printf("Failed to read kernel swappiness: %s", err)
 		return 60
@@ -50,51 +82,190 @@ func readKernelSwappiness() int {
 	return swappiness
 }
 
-func getSwapSize() string {
-	found, err := swapFileEditor.Find(`^SWAPSIZE=`, "", true)
-	if found == nil || err != nil {
+// getSwapFileOption returns the value of a variable in the swapfile
+// configuration. The file is sourced by a shell, so the last assignment wins.
+func getSwapFileOption(name string) string {
+	found, err := swapFileEditor.FindAll(`^`+name+`=(?P<value>.*)`, "", true)
+	if len(found) == 0 || err != nil {
 		return ""
 	}
 
-	matches := regexp.MustCompile(`^SWAPSIZE=(.*)`).FindStringSubmatch(*found)
-	if len(matches) > 1 {
-		return matches[1]
+	return found[len(found)-1].Groups["value"]
+}
+
+func setSwapFileOption(name string, value string) error {
+	params := lineinfile.NewPresentParams(fmt.Sprintf("%s=%s", name, value))
+	params.Regexp, _ = regexp.Compile(`^[#\s]*` + name + `=`)
+
+	changed, err := swapFileEditor.PresentChanged(params)
+	if err != nil {
+		return err
 	}
 
-	return ""
+	if changed {
+		swapMu.Lock()
+		swapConfigPending = true
+		swapMu.Unlock()
+	}
+
+	return nil
+}
+
+func getSwapSize() string {
+	return getSwapFileOption("SWAPSIZE")
 }
 
 func getSwappiness() int {
-	found, err := swappinessEditor.Find(`^vm.swappiness\s*=`, "", true)
-	if found == nil || err != nil {
+	found, err := swappinessEditor.FindAll(`^vm.swappiness\s*=\s*(?P<value>\d+)`, "", true)
+	if len(found) == 0 || err != nil {
 		return readKernelSwappiness()
 	}
 
-	matches := regexp.MustCompile(`^vm.swappiness\s*=\s*(\d+)`).FindStringSubmatch(*found)
-	if len(matches) > 1 {
-		if swappiness, err := strconv.Atoi(matches[1]); err == nil {
-			return swappiness
-		}
+	if swappiness, err := strconv.Atoi(found[len(found)-1].Groups["value"]); err == nil {
+		return swappiness
 	}
 
 	return readKernelSwappiness()
 }
 
+// parseSize converts a swap size as understood by fallocate into bytes: K, M
+// and G (optionally followed by iB) are powers of 1024, KB, MB and GB powers
+// of 1000 and a bare number is a size in bytes.
+func parseSize(size string) (uint64, error) {
+	matches := regexp.MustCompile(`^(\d+)(([KMG]?)(i?B)?)?$`).FindStringSubmatch(size)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid swap size format")
+	}
+
+	value, err := strconv.ParseUint(matches[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid swap size: %w", err)
+	}
+
+	var base uint64 = 1024
+	if matches[4] == "B" {
+		base = 1000
+	}
+
+	var multiplier uint64 = 1
+	switch matches[3] {
+	case "K":
+		multiplier = base
+	case "M":
+		multiplier = base * base
+	case "G":
+		multiplier = base * base * base
+	}
+
+	if value > ^uint64(0)/multiplier {
+		return 0, fmt.Errorf("swap size %s is too large", size)
+	}
+
+	return value * multiplier, nil
+}
+
+// validateSwapSize checks that a swapfile of the given size fits on the data
+// partition with available bytes free (including the space of the current
+// swapfile, which gets replaced) and is sensible for the system memory.
+func validateSwapSize(size uint64, available uint64, memTotal uint64) error {
+	if size == 0 {
+		return nil
+	}
+
+	if memTotal > 0 && size > maxSwapRAMRatio*memTotal {
+		return fmt.Errorf("swap size of %d bytes exceeds %d times the system memory of %d bytes", size, maxSwapRAMRatio, memTotal)
+	}
+
+	if available < minDataFreeSpace || size > available-minDataFreeSpace {
+		return fmt.Errorf("swap size of %d bytes does not fit on the data partition, %d bytes available", size, available)
+	}
+
+	return nil
+}
+
+// availableSwapSpace returns the bytes which could be used for the swapfile
+// on the data partition.
+func availableSwapSpace() (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dataMount, &stat); err != nil {
+		return 0, fmt.Errorf("failed to get free space of %s: %w", dataMount, err)
+	}
+	available := stat.Bavail * uint64(stat.Bsize) //nolint:gosec
+
+	if info, err := os.Stat(swapFilePath); err == nil {
+		available += uint64(info.Size()) //nolint:gosec
+	}
+
+	return available, nil
+}
+
+func getSwapSizeBytes() uint64 {
+	size, err := parseSize(getSwapSize())
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// checkSwapSize parses a requested swap size and checks it against the free
+// space on the data partition and the system memory.
+func checkSwapSize(swapSize string) (uint64, error) {
+	size, err := parseSize(swapSize)
+	if err != nil {
+		return 0, err
+	}
+
+	available, err := availableSwapSpace()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := validateSwapSize(size, available, readMeminfo()["MemTotal"]); err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+func validateSwappiness(swappiness int32) error {
+	if swappiness < 0 || swappiness > 100 {
+		return fmt.Errorf("swappiness must be between 0 and 100")
+	}
+	return nil
+}
+
+// validate checks new values for the writable properties, used to validate
+// all changes of a transaction before any of them is written.
+func validate(changes map[string]any) error {
+	for name, value := range changes {
+		var err error
+		switch name {
+		case "SwapSize":
+			_, err = checkSwapSize(value.(string))
+		case "Swappiness":
+			err = validateSwappiness(value.(int32))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func setSwapSize(c *prop.Change) *dbus.Error {
 	swapSize, ok := c.Value.(string)
 	if !ok {
 		return dbus.MakeFailedError(fmt.Errorf("invalid type for swap size"))
 	}
 
-	re := regexp.MustCompile(`^\d+([KMG]?(i?B)?)?$`)
-	if !re.MatchString(swapSize) {
-		return dbus.MakeFailedError(fmt.Errorf("invalid swap size format"))
+	if _, err := checkSwapSize(swapSize); err != nil {
+		return dbus.MakeFailedError(err)
 	}
 
-	params := lineinfile.NewPresentParams(fmt.Sprintf("SWAPSIZE=%s", swapSize))
-	params.Regexp, _ = regexp.Compile(`^[#\s]*SWAPSIZE=`)
-
-	if err := swapFileEditor.Present(params); err != nil {
+	// SwapSizeBytes is updated by refreshSwapFile once the file was written,
+	// the properties are locked while the callback runs.
+	if err := setSwapFileOption("SWAPSIZE", swapSize); err != nil {
 		return dbus.MakeFailedError(fmt.Errorf("failed to set swap size: %w", err))
 	}
 
@@ -107,8 +278,8 @@ func setSwappiness(c *prop.Change) *dbus.Error {
 		return dbus.MakeFailedError(fmt.Errorf("swappiness must be int32, got %T", c.Value))
 	}
 
-	if swappiness < 0 || swappiness > 100 {
-		return dbus.MakeFailedError(fmt.Errorf("swappiness must be between 0 and 100"))
+	if err := validateSwappiness(swappiness); err != nil {
+		return dbus.MakeFailedError(err)
 	}
 
 	params := lineinfile.NewPresentParams(fmt.Sprintf("vm.swappiness=%d", swappiness))
@@ -118,6 +289,220 @@ func setSwappiness(c *prop.Change) *dbus.Error {
 		return dbus.MakeFailedError(fmt.Errorf("failed to set swappiness: %w", err))
 	}
 
+	swapMu.Lock()
+	optSwappiness = int(swappiness)
+	swapMu.Unlock()
+
+	return nil
+}
+
+// parseMeminfo returns the values of /proc/meminfo in bytes, keyed by their
+// name.
+func parseMeminfo(content string) map[string]uint64 {
+	meminfo := map[string]uint64{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		// Sizes are reported in kB
+		if len(fields) > 2 && fields[2] == "kB" {
+			value *= 1024
+		}
+		meminfo[strings.TrimSuffix(fields[0], ":")] = value
+	}
+
+	return meminfo
+}
+
+// swapUsage returns the swap total and used size in bytes.
+func swapUsage(meminfo map[string]uint64) (uint64, uint64) {
+	total, free := meminfo["SwapTotal"], meminfo["SwapFree"]
+	if free > total {
+		return total, 0
+	}
+	return total, total - free
+}
+
+// parseSwaps returns the active swap devices and files listed in /proc/swaps.
+func parseSwaps(content string) []string {
+	devices := []string{}
+	for idx, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		// Skip the header and empty lines
+		if idx == 0 || len(fields) == 0 {
+			continue
+		}
+		devices = append(devices, fields[0])
+	}
+
+	return devices
+}
+
+// parseZramStat parses the content of a zram mm_stat file into its named
+// counters.
+func parseZramStat(content string) map[string]uint64 {
+	stats := map[string]uint64{}
+	for idx, field := range strings.Fields(content) {
+		if idx >= len(zramStatFields) {
+			break
+		}
+
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			continue
+		}
+		stats[zramStatFields[idx]] = value
+	}
+
+	return stats
+}
+
+// readZramStats returns the mm_stat counters summed over all zram devices.
+func readZramStats() map[string]uint64 {
+	stats := map[string]uint64{}
+
+	files, err := filepath.Glob(filepath.Join(sysBlockPath, "zram*", "mm_stat"))
+	if err != nil {
+		return stats
+	}
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			logging.Warning.Printf("Failed to read %s: %s", file, err)
+			continue
+		}
+
+		for name, value := range parseZramStat(string(content)) {
+			stats[name] += value
+		}
+	}
+
+	return stats
+}
+
+func readMeminfo() map[string]uint64 {
+	content, err := os.ReadFile(procMeminfoPath)
+	if err != nil {
+		logging.Error.Printf("Failed to read %s: %s", procMeminfoPath, err)
+		return map[string]uint64{}
+	}
+
+	return parseMeminfo(string(content))
+}
+
+func readSwapUsage() (uint64, uint64) {
+	return swapUsage(readMeminfo())
+}
+
+func readActiveSwapDevices() []string {
+	content, err := os.ReadFile(procSwapsPath)
+	if err != nil {
+		logging.Error.Printf("Failed to read %s: %s", procSwapsPath, err)
+		return []string{}
+	}
+
+	return parseSwaps(string(content))
+}
+
+// updateUsage refreshes the swap usage properties, signals are only emitted
+// for values which actually changed.
+func (d swap) updateUsage() {
+	total, used := readSwapUsage()
+	if d.props.GetMust(ifaceName, "SwapTotal").(uint64) != total {
+		d.props.SetMust(ifaceName, "SwapTotal", total)
+	}
+	if d.props.GetMust(ifaceName, "SwapUsed").(uint64) != used {
+		d.props.SetMust(ifaceName, "SwapUsed", used)
+	}
+
+	devices := readActiveSwapDevices()
+	if !slices.Equal(d.props.GetMust(ifaceName, "ActiveSwapDevices").([]string), devices) {
+		d.props.SetMust(ifaceName, "ActiveSwapDevices", devices)
+	}
+
+	zramStats := readZramStats()
+	if !maps.Equal(d.props.GetMust(ifaceName, "ZramStats").(map[string]uint64), zramStats) {
+		d.props.SetMust(ifaceName, "ZramStats", zramStats)
+	}
+}
+
+// refreshSwapFile re-reads the swapfile configuration after it was changed.
+// A change made outside of the agent needs a restart of the swapfile service
+// just like one made through the properties. SwapSizeBytes always follows
+// the file, as it is not updated by the SwapSize callback.
+func (d swap) refreshSwapFile() {
+	settings.Refresh(d.props, ifaceName, map[string]any{"SwapSizeBytes": getSwapSizeBytes()})
+
+	if settings.Refresh(d.props, ifaceName, map[string]any{"SwapSize": getSwapSize()}) {
+		logging.Info.Printf("Swap configuration in %s was changed externally", swapPath)
+		swapMu.Lock()
+		swapConfigPending = true
+		swapMu.Unlock()
+	}
+}
+
+func (d swap) refreshSwappiness() {
+	swappiness := getSwappiness()
+
+	swapMu.Lock()
+	optSwappiness = swappiness
+	swapMu.Unlock()
+
+	settings.Refresh(d.props, ifaceName, map[string]any{"Swappiness": int32(swappiness)}) //nolint:gosec
+}
+
+// watchConfig refreshes the properties when the configuration files are
+// edited by hand or replaced by an OS update.
+func (d swap) watchConfig() {
+	if err := filewatch.Watch(swapPath, d.refreshSwapFile); err != nil {
+		logging.Warning.Printf("Failed to watch %s: %s", swapPath, err)
+	}
+	if err := filewatch.Watch(swappinessPath, d.refreshSwappiness); err != nil {
+		logging.Warning.Printf("Failed to watch %s: %s", swappinessPath, err)
+	}
+}
+
+// Apply makes the configured values effective without a reboot: swappiness
+// is written to the kernel and the swapfile service is restarted if the swap
+// size was changed.
+func (d swap) Apply() *dbus.Error {
+	if err := d.apply(); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	// Property callbacks take swapMu with the properties locked, so usage must
+	// only be refreshed once swapMu has been released.
+	d.updateUsage()
+
+	return nil
+}
+
+func (d swap) apply() error {
+	swapMu.Lock()
+	defer swapMu.Unlock()
+
+	swappiness := strconv.Itoa(optSwappiness)
+	if err := os.WriteFile(kernelSwappinessPath, []byte(swappiness), 0644); err != nil { //nolint:gosec
+		return fmt.Errorf("failed to apply swappiness: %w", err)
+	}
+	logging.Info.Printf("Applied swappiness %s", swappiness)
+
+	if swapConfigPending {
+		if err := systemd.RestartUnit(swapUnit); err != nil {
+			return fmt.Errorf("failed to restart %s: %w", swapUnit, err)
+		}
+		swapConfigPending = false
+		logging.Info.Printf("Restarted %s to apply new swap configuration", swapUnit)
+	}
+
 	return nil
 }
 
@@ -128,6 +513,7 @@ func InitializeDBus(conn *dbus.Conn) {
 
 	optSwapSize = getSwapSize()
 	optSwappiness = getSwappiness()
+	swapTotal, swapUsed := readSwapUsage()
 
 	propsSpec := map[string]map[string]*prop.Prop{
 		ifaceName: {
@@ -137,12 +523,42 @@ func InitializeDBus(conn *dbus.Conn) {
 				Emit:     prop.EmitTrue,
 				Callback: setSwapSize,
 			},
+			"SwapSizeBytes": {
+				Value:    getSwapSizeBytes(),
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
 			"Swappiness": {
-				Value:    optSwappiness,
+				Value:    int32(optSwappiness), //nolint:gosec
 				Writable: true,
 				Emit:     prop.EmitTrue,
 				Callback: setSwappiness,
 			},
+			"SwapTotal": {
+				Value:    swapTotal,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"SwapUsed": {
+				Value:    swapUsed,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"ActiveSwapDevices": {
+				Value:    readActiveSwapDevices(),
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"ZramStats": {
+				Value:    readZramStats(),
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
 		},
 	}
 
@@ -151,6 +567,13 @@ func InitializeDBus(conn *dbus.Conn) {
 		logging.Critical.Panic(err)
 	}
 	d.props = props
+	files := []string{swapPath, swappinessPath}
+	settings.Register(ifaceName, props, []string{"SwapSize", "Swappiness"}, files, validate)
+
+	err = filehistory.ExportProperties(conn, objectPath, props, files)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
 
 	err = conn.Export(d, objectPath, ifaceName)
 	if err != nil {
@@ -176,4 +599,12 @@ func InitializeDBus(conn *dbus.Conn) {
 	}
 
 	logging.Info.Printf("Exposing object %s with interface %s ...", objectPath, ifaceName)
+
+	d.watchConfig()
+
+	go func() {
+		for range time.Tick(usageRefreshInterval) {
+			d.updateUsage()
+		}
+	}()
 }
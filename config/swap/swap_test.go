@@ -0,0 +1,134 @@
+package swap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMeminfo(t *testing.T) {
+	content := `MemTotal:        3884348 kB
+MemFree:          169532 kB
+SwapCached:         1024 kB
+SwapTotal:       1048572 kB
+SwapFree:         786428 kB
+Zswap:                 0 kB
+`
+	meminfo := parseMeminfo(content)
+	if meminfo["MemTotal"] != 3884348*1024 {
+		t.Errorf("unexpected memory total %d", meminfo["MemTotal"])
+	}
+
+	total, used := swapUsage(meminfo)
+	if total != 1048572*1024 {
+		t.Errorf("unexpected swap total %d", total)
+	}
+	if used != (1048572-786428)*1024 {
+		t.Errorf("unexpected swap used %d", used)
+	}
+}
+
+func TestParseMeminfoNoSwap(t *testing.T) {
+	total, used := swapUsage(parseMeminfo("MemTotal:        3884348 kB\n"))
+	if total != 0 || used != 0 {
+		t.Errorf("expected no swap, got %d / %d", total, used)
+	}
+}
+
+func TestParseSwaps(t *testing.T) {
+	content := `Filename				Type		Size		Used		Priority
+/mnt/data/swapfile                      file		1048572		262144		-2
+/dev/zram0                              partition	524284		0		100
+`
+	got := parseSwaps(content)
+	want := []string{"/mnt/data/swapfile", "/dev/zram0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSwaps() = %v, want %v", got, want)
+	}
+}
+
+func TestParseSwapsEmpty(t *testing.T) {
+	got := parseSwaps("Filename				Type		Size		Used		Priority\n")
+	if len(got) != 0 {
+		t.Errorf("expected no swap devices, got %v", got)
+	}
+}
+
+func TestParseZramStat(t *testing.T) {
+	got := parseZramStat("  2609152   628531  1306624        0  1306624      176        0        0        0\n")
+	want := map[string]uint64{
+		"orig_data_size":  2609152,
+		"compr_data_size": 628531,
+		"mem_used_total":  1306624,
+		"mem_limit":       0,
+		"mem_used_max":    1306624,
+		"same_pages":      176,
+		"pages_compacted": 0,
+		"huge_pages":      0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseZramStat() = %v, want %v", got, want)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := []struct {
+		in   string
+		want uint64
+	}{
+		{"0", 0},
+		{"4096", 4096},
+		{"512K", 512 << 10},
+		{"512KiB", 512 << 10},
+		{"512KB", 512000},
+		{"2M", 2 << 20},
+		{"2G", 2 << 30},
+		{"2GiB", 2 << 30},
+		{"2GB", 2000000000},
+	}
+	for _, c := range cases {
+		got, err := parseSize(c.in)
+		if err != nil {
+			t.Errorf("parseSize(%q) failed: %s", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseSize(%q) = %d, want %d", c.in, got, c.want)
+		}
+	}
+
+	for _, in := range []string{"", "G", "-1G", "1T", "1.5G", "1 G", "99999999999999999999G"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) expected an error", in)
+		}
+	}
+}
+
+func TestValidateSwapSize(t *testing.T) {
+	const gib = 1 << 30
+	cases := []struct {
+		name      string
+		size      uint64
+		available uint64
+		memTotal  uint64
+		valid     bool
+	}{
+		{"disabled", 0, 0, 4 * gib, true},
+		{"fits", 2 * gib, 10 * gib, 4 * gib, true},
+		{"unknown memory", 2 * gib, 10 * gib, 0, true},
+		{"exceeds disk", 64 * gib, 32 * gib, 32 * gib, false},
+		{"no space left", 2 * gib, 2 * gib, 4 * gib, false},
+		{"nearly full disk", 1 * gib, 512 << 20, 4 * gib, false},
+		{"exceeds memory ratio", 20 * gib, 100 * gib, 4 * gib, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateSwapSize(c.size, c.available, c.memTotal)
+			if c.valid && err != nil {
+				t.Errorf("expected size to be valid, got error: %s", err)
+			}
+			if !c.valid && err == nil {
+				t.Errorf("expected size to be rejected")
+			}
+		})
+	}
+}
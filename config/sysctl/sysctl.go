@@ -0,0 +1,386 @@
+package sysctl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/home-assistant/os-agent/utils/filehistory"
+	"github.com/home-assistant/os-agent/utils/lineinfile"
+	logging "github.com/home-assistant/os-agent/utils/log"
+)
+
+const (
+	objectPath = "/io/hass/os/Config/Sysctl"
+	ifaceName  = "io.hass.os.Config.Sysctl"
+	sysctlConf = "/etc/sysctl.d/20-os-agent.conf"
+	procSysDir = "/proc/sys"
+)
+
+// sysctlKey describes a kernel parameter which may be changed through the
+// agent along with the range of values accepted for it.
+type sysctlKey struct {
+	min uint64
+	max uint64
+}
+
+// allowedKeys is the list of kernel parameters the agent manages. Anything
+// else is rejected, vm.swappiness is owned by the Config.Swap interface.
+var allowedKeys = map[string]sysctlKey{
+	"fs.file-max":                   {min: 8192, max: 1<<63 - 1},
+	"fs.inotify.max_user_instances": {min: 128, max: 1<<31 - 1},
+	"fs.inotify.max_user_watches":   {min: 8192, max: 1<<31 - 1},
+	"fs.inotify.max_queued_events":  {min: 16384, max: 1<<31 - 1},
+	"net.core.rmem_max":             {min: 4096, max: 1<<31 - 1},
+	"net.core.wmem_max":             {min: 4096, max: 1<<31 - 1},
+	"net.core.netdev_max_backlog":   {min: 1000, max: 1<<31 - 1},
+	"net.ipv4.igmp_max_memberships": {min: 20, max: 1<<31 - 1},
+}
+
+var (
+	configFile = lineinfile.LineInFile{FilePath: sysctlConf}
+	// sysctlMu serializes modifications of the sysctl configuration file.
+	sysctlMu sync.Mutex
+	// exported is the object on the bus, its Settings property is updated
+	// when the settings are replaced by a configuration import.
+	exported sysctl
+)
+
+type sysctl struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+}
+
+// validateSetting checks that key is on the allowlist and value is within
+// its accepted range. The value is returned in normalized form.
+func validateSetting(key string, value string) (string, error) {
+	limits, ok := allowedKeys[key]
+	if !ok {
+		return "", fmt.Errorf("sysctl key %q is not supported", key)
+	}
+
+	number, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("value for %s must be an unsigned integer", key)
+	}
+	if number < limits.min || number > limits.max {
+		return "", fmt.Errorf("value for %s must be between %d and %d", key, limits.min, limits.max)
+	}
+
+	return strconv.FormatUint(number, 10), nil
+}
+
+// procPath returns the /proc/sys file backing the given sysctl key.
+func procPath(root string, key string) string {
+	return filepath.Join(root, strings.ReplaceAll(key, ".", "/"))
+}
+
+func keyRegexp(key string) *regexp.Regexp {
+	return regexp.MustCompile(`^[#\s]*` + regexp.QuoteMeta(key) + `\s*=`)
+}
+
+func readKernelValue(key string) (string, error) {
+	content, err := os.ReadFile(procPath(procSysDir, key))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+func applyKernelValue(key string, value string) error {
+	return os.WriteFile(procPath(procSysDir, key), []byte(value), 0644) //nolint:gosec
+}
+
+// getSettings returns all values persisted in the agent's sysctl.d file.
+func getSettings() map[string]string {
+	settings := map[string]string{}
+
+	found, err := configFile.FindAll(`^\s*(?P<key>[a-z0-9_.\-]+)\s*=\s*(?P<value>.*?)\s*$`, "", true)
+	if err != nil {
+		return settings
+	}
+
+	for _, match := range found {
+		if _, ok := allowedKeys[match.Groups["key"]]; ok {
+			settings[match.Groups["key"]] = match.Groups["value"]
+		}
+	}
+
+	return settings
+}
+
+// replaceSettings persists exactly the given settings, which must be
+// validated and normalized already. Persisted keys not given are removed.
+func replaceSettings(values map[string]string) (bool, error) {
+	changed := false
+	for key := range getSettings() {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		params := lineinfile.NewAbsentParams()
+		params.Regexp = regexp.MustCompile(`^\s*` + regexp.QuoteMeta(key) + `\s*=`)
+		removed, err := configFile.AbsentChanged(params)
+		if err != nil {
+			return changed, fmt.Errorf("failed to reset %s: %w", key, err)
+		}
+		changed = changed || removed
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		params := lineinfile.NewPresentParams(fmt.Sprintf("%s=%s", key, values[key]))
+		params.Regexp = keyRegexp(key)
+		written, err := configFile.PresentChanged(params)
+		if err != nil {
+			return changed, fmt.Errorf("failed to set %s: %w", key, err)
+		}
+		changed = changed || written
+	}
+
+	return changed, nil
+}
+
+// Settings returns the settings persisted by the agent.
+func Settings() map[string]string {
+	sysctlMu.Lock()
+	defer sysctlMu.Unlock()
+
+	return getSettings()
+}
+
+// SettingsFile returns the sysctl.d file the settings are persisted in.
+func SettingsFile() string {
+	return configFile.FilePath
+}
+
+// ValidateSettings checks settings the way Set does.
+func ValidateSettings(values map[string]string) error {
+	for key, value := range values {
+		if _, err := validateSetting(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceSettings persists exactly the given settings and applies them to
+// the kernel. Settings not given are reset, their kernel values stay
+// unchanged until the next reboot.
+func ReplaceSettings(values map[string]string) error {
+	normalized := make(map[string]string, len(values))
+	for key, value := range values {
+		value, err := validateSetting(key, value)
+		if err != nil {
+			return err
+		}
+		normalized[key] = value
+	}
+
+	sysctlMu.Lock()
+	defer sysctlMu.Unlock()
+
+	changed, err := replaceSettings(normalized)
+	if changed && exported.props != nil {
+		exported.props.SetMust(ifaceName, "Settings", getSettings())
+	}
+	if err != nil {
+		return err
+	}
+
+	for key, value := range normalized {
+		if err := applyKernelValue(key, value); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", key, err)
+		}
+	}
+
+	logging.Info.Printf("Replaced sysctl settings with %d values", len(normalized))
+	return nil
+}
+
+// Reload re-reads the persisted settings, e.g. after the file was restored,
+// and applies them to the kernel. Kernel values of settings which are no
+// longer persisted stay unchanged until the next reboot.
+func Reload() error {
+	sysctlMu.Lock()
+	defer sysctlMu.Unlock()
+
+	persisted := getSettings()
+	if exported.props != nil {
+		exported.props.SetMust(ifaceName, "Settings", persisted)
+	}
+
+	for key, value := range persisted {
+		if err := applyKernelValue(key, value); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func (d sysctl) Get(key string) (string, *dbus.Error) {
+	if _, ok := allowedKeys[key]; !ok {
+		return "", dbus.MakeFailedError(fmt.Errorf("sysctl key %q is not supported", key))
+	}
+
+	value, err := readKernelValue(key)
+	if err != nil {
+		return "", dbus.MakeFailedError(fmt.Errorf("failed to read %s: %w", key, err))
+	}
+
+	return value, nil
+}
+
+func (d sysctl) Set(sender dbus.Sender, key string, value string, apply bool) *dbus.Error {
+	value, err := validateSetting(key, value)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	err = filehistory.Track(string(sender), []string{configFile.FilePath}, func() error {
+		return d.set(key, value, apply)
+	})
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	return nil
+}
+
+func (d sysctl) set(key string, value string, apply bool) error {
+	sysctlMu.Lock()
+	defer sysctlMu.Unlock()
+
+	params := lineinfile.NewPresentParams(fmt.Sprintf("%s=%s", key, value))
+	params.Regexp = keyRegexp(key)
+	changed, err := configFile.PresentChanged(params)
+	if err != nil {
+		return fmt.Errorf("failed to set %s: %w", key, err)
+	}
+
+	if changed {
+		logging.Info.Printf("Set sysctl %s to %s", key, value)
+		d.props.SetMust(ifaceName, "Settings", getSettings())
+	}
+
+	if apply {
+		if err := applyKernelValue(key, value); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// Reset removes a persisted setting, the kernel value stays unchanged until
+// the next reboot.
+func (d sysctl) Reset(sender dbus.Sender, key string) *dbus.Error {
+	if _, ok := allowedKeys[key]; !ok {
+		return dbus.MakeFailedError(fmt.Errorf("sysctl key %q is not supported", key))
+	}
+
+	err := filehistory.Track(string(sender), []string{configFile.FilePath}, func() error {
+		return d.reset(key)
+	})
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	return nil
+}
+
+func (d sysctl) reset(key string) error {
+	sysctlMu.Lock()
+	defer sysctlMu.Unlock()
+
+	params := lineinfile.NewAbsentParams()
+	params.Regexp = regexp.MustCompile(`^\s*` + regexp.QuoteMeta(key) + `\s*=`)
+	changed, err := configFile.AbsentChanged(params)
+	if err != nil {
+		return fmt.Errorf("failed to reset %s: %w", key, err)
+	}
+
+	if changed {
+		logging.Info.Printf("Reset sysctl %s", key)
+		d.props.SetMust(ifaceName, "Settings", getSettings())
+	}
+
+	return nil
+}
+
+func InitializeDBus(conn *dbus.Conn) {
+	d := sysctl{
+		conn: conn,
+	}
+
+	keys := make([]string, 0, len(allowedKeys))
+	for key := range allowedKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	propsSpec := map[string]map[string]*prop.Prop{
+		ifaceName: {
+			"AllowedKeys": {
+				Value:    keys,
+				Writable: false,
+				Emit:     prop.EmitInvalidates,
+				Callback: nil,
+			},
+			"Settings": {
+				Value:    getSettings(),
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+		},
+	}
+
+	props, err := prop.Export(conn, objectPath, propsSpec)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+	d.props = props
+	exported = d
+	filehistory.Manage(configFile.FilePath)
+
+	err = conn.Export(d, objectPath, ifaceName)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	node := &introspect.Node{
+		Name: objectPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       ifaceName,
+				Methods:    introspect.Methods(d),
+				Properties: props.Introspection(ifaceName),
+			},
+		},
+	}
+
+	err = conn.Export(introspect.NewIntrospectable(node), objectPath, "org.freedesktop.DBus.Introspectable")
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	logging.Info.Printf("Exposing object %s with interface %s ...", objectPath, ifaceName)
+}
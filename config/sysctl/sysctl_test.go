@@ -0,0 +1,98 @@
+package sysctl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/home-assistant/os-agent/utils/lineinfile"
+)
+
+func TestValidateSetting(t *testing.T) {
+	cases := []struct {
+		key, value, want string
+		valid            bool
+	}{
+		{"fs.inotify.max_user_watches", "524288", "524288", true},
+		{"fs.inotify.max_user_watches", " 524288\n", "524288", true},
+		{"net.core.rmem_max", "4194304", "4194304", true},
+		{"fs.inotify.max_user_watches", "100", "", false},
+		{"fs.inotify.max_user_watches", "-1", "", false},
+		{"fs.inotify.max_user_watches", "1 2", "", false},
+		{"fs.inotify.max_user_watches", "4294967296", "", false},
+		{"vm.swappiness", "10", "", false},
+		{"kernel.core_pattern", "|/bin/sh", "", false},
+	}
+	for _, c := range cases {
+		got, err := validateSetting(c.key, c.value)
+		if c.valid && err != nil {
+			t.Errorf("validateSetting(%q, %q) failed: %s", c.key, c.value, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("validateSetting(%q, %q) = %q, expected an error", c.key, c.value, got)
+		}
+		if got != c.want {
+			t.Errorf("validateSetting(%q, %q) = %q, want %q", c.key, c.value, got, c.want)
+		}
+	}
+}
+
+func TestProcPath(t *testing.T) {
+	got := procPath("/proc/sys", "fs.inotify.max_user_watches")
+	if got != "/proc/sys/fs/inotify/max_user_watches" {
+		t.Errorf("unexpected path %q", got)
+	}
+}
+
+func TestReplaceSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "20-os-agent.conf")
+	content := "# Managed by os-agent\nfs.file-max=100000\nnet.core.rmem_max=4194304\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+	previous := configFile
+	configFile = lineinfile.LineInFile{FilePath: path}
+	t.Cleanup(func() { configFile = previous })
+
+	changed, err := replaceSettings(map[string]string{"net.core.rmem_max": "8388608", "fs.inotify.max_user_watches": "524288"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Errorf("expected the settings to change")
+	}
+
+	got := getSettings()
+	want := map[string]string{"net.core.rmem_max": "8388608", "fs.inotify.max_user_watches": "524288"}
+	if len(got) != len(want) {
+		t.Fatalf("got settings %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("got settings %v, want %v", got, want)
+		}
+	}
+
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(written), "# Managed by os-agent\n") {
+		t.Errorf("comment was not kept:\n%s", written)
+	}
+
+	changed, err = replaceSettings(want)
+	if err != nil || changed {
+		t.Errorf("expected no change replacing with the same settings, got %t, %v", changed, err)
+	}
+}
+
+func TestValidateSettings(t *testing.T) {
+	if err := ValidateSettings(map[string]string{"fs.file-max": "100000"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := ValidateSettings(map[string]string{"fs.file-max": "100000", "vm.swappiness": "10"}); err == nil {
+		t.Errorf("expected an error for an unsupported key")
+	}
+}
@@ -0,0 +1,120 @@
+package timesyncd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/home-assistant/os-agent/utils/inifile"
+)
+
+const (
+	configName = "timesyncd.conf"
+	dropInDir  = "/etc/systemd/timesyncd.conf.d"
+	dropInName = "90-os-agent.conf"
+)
+
+var (
+	// configRoots are the directories systemd reads timesyncd.conf and its
+	// drop-ins from, in order of precedence.
+	configRoots = []string{"/etc/systemd", "/run/systemd", "/usr/local/lib/systemd", "/usr/lib/systemd"}
+	// listOptions accumulate over all assignments, an empty assignment resets
+	// the list. All other options use the last assignment.
+	listOptions = map[string]bool{"NTP": true, "FallbackNTP": true}
+	configFile  = inifile.IniFile{FilePath: filepath.Join(dropInDir, dropInName)}
+	// dropInMu serializes modifications of the agent's drop-in file.
+	dropInMu sync.Mutex
+
+	timespanRegexp = regexp.MustCompile(`(\d+)\s*([a-z]*)`)
+)
+
+// configFiles returns timesyncd.conf followed by all its drop-ins in the
+// order systemd applies them.
+func configFiles(roots []string) []string {
+	return inifile.ConfigFiles(roots, configName)
+}
+
+// mergeConfig returns the effective options of the given files. Options never
+// assigned are missing from the result, list options are space separated.
+func mergeConfig(files []string) map[string]string {
+	return inifile.Merge(files, "Time", listOptions)
+}
+
+// getConfigOption returns the effective value of a timesyncd option.
+func getConfigOption(name string) (string, bool) {
+	value, ok := mergeConfig(configFiles(configRoots))[name]
+	return value, ok
+}
+
+// setConfigOption stores an option in the agent's drop-in. List options are
+// reset first so they replace the servers of the main configuration instead
+// of extending them.
+func setConfigOption(name string, value string) error {
+	dropInMu.Lock()
+	defer dropInMu.Unlock()
+
+	assignments := []string{value}
+	if listOptions[name] {
+		assignments = []string{""}
+		if value != "" {
+			assignments = append(assignments, value)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configFile.FilePath), 0o755); err != nil { //nolint:gosec
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(configFile.FilePath), err)
+	}
+	if err := configFile.SetAll("Time", name, assignments); err != nil {
+		return fmt.Errorf("failed to set %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// parseTimespan converts a systemd time span (e.g. "32", "1min 30s") into
+// whole seconds.
+func parseTimespan(value string) (uint32, error) {
+	value = strings.TrimSpace(value)
+	matches := timespanRegexp.FindAllStringSubmatch(value, -1)
+	if len(matches) == 0 || strings.TrimSpace(timespanRegexp.ReplaceAllString(value, "")) != "" {
+		return 0, fmt.Errorf("invalid time span %q", value)
+	}
+
+	var usec uint64
+	for _, m := range matches {
+		number, err := strconv.ParseUint(m[1], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time span %q", value)
+		}
+
+		var unit uint64
+		switch m[2] {
+		case "us", "usec":
+			unit = 1
+		case "ms", "msec":
+			unit = 1000
+		case "", "s", "sec", "second", "seconds":
+			unit = 1000000
+		case "m", "min", "minute", "minutes":
+			unit = 60 * 1000000
+		case "h", "hr", "hour", "hours":
+			unit = 3600 * 1000000
+		case "d", "day", "days":
+			unit = 86400 * 1000000
+		default:
+			return 0, fmt.Errorf("invalid time span unit %q", m[2])
+		}
+		usec += number * unit
+	}
+
+	seconds := usec / 1000000
+	if seconds > 1<<32-1 {
+		return 0, fmt.Errorf("time span %q is too large", value)
+	}
+
+	return uint32(seconds), nil
+}
@@ -0,0 +1,184 @@
+package timesyncd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/home-assistant/os-agent/utils/inifile"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create directory: %s", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+}
+
+func TestConfigFilesOrder(t *testing.T) {
+	root := t.TempDir()
+	etc := filepath.Join(root, "etc")
+	usr := filepath.Join(root, "usr")
+
+	writeFile(t, filepath.Join(usr, "timesyncd.conf"), "[Time]\n")
+	writeFile(t, filepath.Join(usr, "timesyncd.conf.d", "10-vendor.conf"), "[Time]\n")
+	writeFile(t, filepath.Join(usr, "timesyncd.conf.d", "20-masked.conf"), "[Time]\n")
+	writeFile(t, filepath.Join(etc, "timesyncd.conf.d", "20-masked.conf"), "[Time]\n")
+	writeFile(t, filepath.Join(etc, "timesyncd.conf.d", "90-os-agent.conf"), "[Time]\n")
+	writeFile(t, filepath.Join(etc, "timesyncd.conf.d", "ignored.txt"), "[Time]\n")
+
+	got := configFiles([]string{etc, usr})
+	want := []string{
+		filepath.Join(usr, "timesyncd.conf"),
+		filepath.Join(usr, "timesyncd.conf.d", "10-vendor.conf"),
+		filepath.Join(etc, "timesyncd.conf.d", "20-masked.conf"),
+		filepath.Join(etc, "timesyncd.conf.d", "90-os-agent.conf"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("configFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestMergeConfig(t *testing.T) {
+	root := t.TempDir()
+	main := filepath.Join(root, "timesyncd.conf")
+	vendor := filepath.Join(root, "10-vendor.conf")
+	agent := filepath.Join(root, "90-os-agent.conf")
+
+	writeFile(t, main, `[Time]
+NTP=ntp1.example.com
+#FallbackNTP=commented.example.com
+FallbackNTP=time.cloudflare.com
+PollIntervalMinSec=32
+[Other]
+NTP=ignored.example.com
+`)
+	writeFile(t, vendor, `[Time]
+NTP=ntp2.example.com
+PollIntervalMinSec=64
+`)
+	writeFile(t, agent, `[Time]
+FallbackNTP=
+SaveIntervalSec=120
+`)
+
+	got := mergeConfig([]string{main, vendor, agent})
+	want := map[string]string{
+		"NTP":                "ntp1.example.com ntp2.example.com",
+		"FallbackNTP":        "",
+		"PollIntervalMinSec": "64",
+		"SaveIntervalSec":    "120",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeConfig() = %v, want %v", got, want)
+	}
+
+	writeFile(t, agent, "[Time]\nNTP=\nNTP=ntp.home.arpa\n")
+	got = mergeConfig([]string{main, vendor, agent})
+	if got["NTP"] != "ntp.home.arpa" {
+		t.Errorf("expected drop-in to replace servers, got %q", got["NTP"])
+	}
+}
+
+func useDropIn(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "timesyncd.conf.d", dropInName)
+	previous := configFile
+	configFile = inifile.IniFile{FilePath: path}
+	t.Cleanup(func() { configFile = previous })
+	return path
+}
+
+func TestSetConfigOption(t *testing.T) {
+	path := useDropIn(t)
+
+	for _, option := range [][2]string{
+		{"NTP", "ntp1.example.com"},
+		{"PollIntervalMaxSec", "1024"},
+		{"FallbackNTP", ""},
+		{"NTP", "ntp1.example.com ntp2.example.com"},
+	} {
+		if err := setConfigOption(option[0], option[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[Time]
+NTP=
+NTP=ntp1.example.com ntp2.example.com
+PollIntervalMaxSec=1024
+FallbackNTP=
+`
+	if string(content) != want {
+		t.Errorf("unexpected drop-in %q, want %q", content, want)
+	}
+}
+
+func TestSetConfigOptionKeepsManualChanges(t *testing.T) {
+	path := useDropIn(t)
+	writeFile(t, path, `# Local overrides
+[Time]
+# Slower polling on metered connections
+PollIntervalMinSec=64
+`)
+
+	if err := setConfigOption("PollIntervalMinSec", "128"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setConfigOption("NTP", "ntp.home.arpa"); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Local overrides
+[Time]
+# Slower polling on metered connections
+PollIntervalMinSec=128
+NTP=
+NTP=ntp.home.arpa
+`
+	if string(content) != want {
+		t.Errorf("unexpected drop-in %q, want %q", content, want)
+	}
+}
+
+func TestParseTimespan(t *testing.T) {
+	cases := []struct {
+		in   string
+		want uint32
+	}{
+		{"32", 32},
+		{"32s", 32},
+		{"5min", 300},
+		{"1min 30s", 90},
+		{"2h", 7200},
+		{"1500ms", 1},
+	}
+	for _, c := range cases {
+		got, err := parseTimespan(c.in)
+		if err != nil {
+			t.Errorf("parseTimespan(%q) failed: %s", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseTimespan(%q) = %d, want %d", c.in, got, c.want)
+		}
+	}
+
+	for _, in := range []string{"", "abc", "5 parsecs", "-5"} {
+		if _, err := parseTimespan(in); err == nil {
+			t.Errorf("parseTimespan(%q) expected an error", in)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package timesyncd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	ntpPort       = "123"
+	ntpPacketSize = 48
+	// ntpEpochOffset is the number of seconds between the NTP epoch (1900)
+	// and the Unix epoch (1970).
+	ntpEpochOffset = 2208988800
+	// ntpClientHeader sets leap indicator 0, version 4 and mode 3 (client).
+	ntpClientHeader = 0x23
+	ntpModeServer   = 4
+	sntpTimeout     = 5 * time.Second
+)
+
+// toNTPTime converts a time into the 64 bit NTP timestamp format.
+func toNTPTime(t time.Time) uint64 {
+	seconds := uint64(t.Unix() + ntpEpochOffset)                     //nolint:gosec
+	fraction := (uint64(t.Nanosecond()) << 32) / uint64(time.Second) //nolint:gosec
+	return seconds<<32 | fraction
+}
+
+// fromNTPTime converts a 64 bit NTP timestamp into a time.
+func fromNTPTime(ts uint64) time.Time {
+	seconds := int64(ts>>32) - ntpEpochOffset                             //nolint:gosec
+	nanoseconds := int64(((ts & 0xffffffff) * uint64(time.Second)) >> 32) //nolint:gosec
+	return time.Unix(seconds, nanoseconds)
+}
+
+// sntpQuery performs a single SNTP (RFC 4330) request against address and
+// returns the offset of the local clock to the server.
+func sntpQuery(address string, timeout time.Duration) (time.Duration, error) {
+	conn, err := net.DialTimeout("udp", address, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+
+	request := make([]byte, ntpPacketSize)
+	request[0] = ntpClientHeader
+	originTime := time.Now()
+	origin := toNTPTime(originTime)
+	binary.BigEndian.PutUint64(request[40:], origin)
+
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+
+	response := make([]byte, ntpPacketSize)
+	n, err := conn.Read(response)
+	if err != nil {
+		return 0, err
+	}
+	destTime := time.Now()
+
+	if n < ntpPacketSize {
+		return 0, errors.New("short NTP response")
+	}
+	if mode := response[0] & 0x07; mode != ntpModeServer {
+		return 0, fmt.Errorf("unexpected NTP mode %d in response", mode)
+	}
+	if stratum := response[1]; stratum == 0 {
+		return 0, fmt.Errorf("server sent kiss-o'-death %q", string(response[12:16]))
+	}
+	if binary.BigEndian.Uint64(response[24:]) != origin {
+		return 0, errors.New("NTP response does not match the request")
+	}
+
+	receiveTime := fromNTPTime(binary.BigEndian.Uint64(response[32:]))
+	transmitTime := fromNTPTime(binary.BigEndian.Uint64(response[40:]))
+
+	return (receiveTime.Sub(originTime) + transmitTime.Sub(destTime)) / 2, nil
+}
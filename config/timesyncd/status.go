@@ -0,0 +1,178 @@
+package timesyncd
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	logging "github.com/home-assistant/os-agent/utils/log"
+)
+
+const (
+	timesync1Name   = "org.freedesktop.timesync1"
+	timesync1Path   = "/org/freedesktop/timesync1"
+	timesync1Iface  = "org.freedesktop.timesync1.Manager"
+	timedate1Name   = "org.freedesktop.timedate1"
+	timedate1Path   = "/org/freedesktop/timedate1"
+	timedate1Iface  = "org.freedesktop.timedate1"
+	propertiesIface = "org.freedesktop.DBus.Properties"
+	statusTimeout   = 5 * time.Second
+)
+
+// ntpMessage mirrors the NTPMessage property of timesyncd, all timestamps are
+// in microseconds of CLOCK_REALTIME.
+type ntpMessage struct {
+	Leap              uint32
+	Version           uint32
+	Mode              uint32
+	Stratum           uint32
+	Precision         int32
+	RootDelay         uint64
+	RootDispersion    uint64
+	Reference         []byte
+	OriginTimestamp   uint64
+	ReceiveTimestamp  uint64
+	TransmitTimestamp uint64
+	DestTimestamp     uint64
+	Spike             bool
+	PacketCount       uint64
+	Jitter            uint64
+}
+
+// ntpAddress mirrors the ServerAddress property of timesyncd.
+type ntpAddress struct {
+	Family  int32
+	Address []byte
+}
+
+type syncStatus struct {
+	serverName    string
+	serverAddress string
+	synchronized  bool
+	lastSyncTime  uint64
+	offset        int64
+	pollInterval  uint64
+}
+
+// offset calculates the clock offset of the last NTP exchange in
+// microseconds, following RFC 5905.
+func (m ntpMessage) offset() int64 {
+	if m.DestTimestamp == 0 {
+		return 0
+	}
+
+	//nolint:gosec // timestamps are far below the int64 range
+	return ((int64(m.ReceiveTimestamp) - int64(m.OriginTimestamp)) +
+		(int64(m.TransmitTimestamp) - int64(m.DestTimestamp))) / 2
+}
+
+// formatAddress turns the raw ServerAddress into its textual form.
+func formatAddress(address ntpAddress) string {
+	if len(address.Address) != net.IPv4len && len(address.Address) != net.IPv6len {
+		return ""
+	}
+	return net.IP(address.Address).String()
+}
+
+// statusBus is the part of the bus connection the synchronization status is
+// read and watched through.
+type statusBus interface {
+	Object(dest string, path dbus.ObjectPath) dbus.BusObject
+	AddMatchSignal(options ...dbus.MatchOption) error
+	Signal(ch chan<- *dbus.Signal)
+}
+
+func getProperty(bus statusBus, dest string, path dbus.ObjectPath, iface string, name string, value any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	return bus.Object(dest, path).CallWithContext(ctx, propertiesIface+".Get", 0, iface, name).Store(value)
+}
+
+// readSyncStatus collects the live synchronization state from timesyncd and
+// timedated. Values which can't be read are left at their zero value.
+func readSyncStatus(bus statusBus) syncStatus {
+	var status syncStatus
+
+	if err := getProperty(bus, timesync1Name, timesync1Path, timesync1Iface, "ServerName", &status.serverName); err != nil {
+		logging.Warning.Printf("Failed to read timesyncd status: %s", err)
+	}
+
+	var address ntpAddress
+	if err := getProperty(bus, timesync1Name, timesync1Path, timesync1Iface, "ServerAddress", &address); err == nil {
+		status.serverAddress = formatAddress(address)
+	}
+
+	var message ntpMessage
+	if err := getProperty(bus, timesync1Name, timesync1Path, timesync1Iface, "NTPMessage", &message); err == nil {
+		status.lastSyncTime = message.DestTimestamp
+		status.offset = message.offset()
+	}
+
+	var pollInterval uint64
+	if err := getProperty(bus, timesync1Name, timesync1Path, timesync1Iface, "PollIntervalUSec", &pollInterval); err == nil {
+		status.pollInterval = pollInterval
+	}
+
+	if err := getProperty(bus, timedate1Name, timedate1Path, timedate1Iface, "NTPSynchronized", &status.synchronized); err != nil {
+		logging.Warning.Printf("Failed to read time synchronization state: %s", err)
+	}
+
+	return status
+}
+
+func (d timesyncd) updateSyncStatus() {
+	status := readSyncStatus(d.conn)
+
+	values := map[string]any{
+		"ServerName":    status.serverName,
+		"ServerAddress": status.serverAddress,
+		"Synchronized":  status.synchronized,
+		"LastSyncTime":  status.lastSyncTime,
+		"Offset":        status.offset,
+		"PollInterval":  status.pollInterval,
+	}
+	for name, value := range values {
+		if d.props.GetMust(ifaceName, name) != value {
+			d.props.SetMust(ifaceName, name, value)
+		}
+	}
+}
+
+// watchSyncStatus refreshes the status properties whenever timesyncd reports
+// changed properties, e.g. after each NTP exchange. timedated does not signal
+// NTPSynchronized changes, so it is re-read at the same time.
+func (d timesyncd) watchSyncStatus() {
+	if err := watchStatusSignals(d.conn, d.updateSyncStatus); err != nil {
+		logging.Error.Printf("Failed to watch timesyncd status: %s", err)
+	}
+}
+
+// watchStatusSignals calls update for every PropertiesChanged signal of
+// timesyncd.
+func watchStatusSignals(bus statusBus, update func()) error {
+	err := bus.AddMatchSignal(
+		dbus.WithMatchObjectPath(timesync1Path),
+		dbus.WithMatchInterface(propertiesIface),
+		dbus.WithMatchMember("PropertiesChanged"),
+	)
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan *dbus.Signal, 10)
+	bus.Signal(signals)
+
+	go func() {
+		for signal := range signals {
+			if signal.Path != timesync1Path || signal.Name != propertiesIface+".PropertiesChanged" {
+				continue
+			}
+			update()
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package timesyncd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// statusObject stands in for the timesyncd and timedated objects. Property
+// values are marshalled like replies on the bus, so structs arrive as the
+// plain values godbus decodes them to.
+type statusObject struct {
+	dbus.BusObject
+	t          *testing.T
+	properties map[string]any
+}
+
+func (o statusObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...any) *dbus.Call {
+	value, ok := o.properties[args[1].(string)]
+	if method != propertiesIface+".Get" || !ok {
+		return &dbus.Call{Err: errors.New("org.freedesktop.DBus.Error.UnknownProperty")}
+	}
+
+	variant := dbus.MakeVariant(value)
+	reply := &dbus.Message{
+		Type: dbus.TypeMethodReply,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldReplySerial: dbus.MakeVariant(uint32(1)),
+			dbus.FieldSignature:   dbus.MakeVariant(dbus.SignatureOf(variant)),
+		},
+		Body: []any{variant},
+	}
+	var buf bytes.Buffer
+	if err := reply.EncodeTo(&buf, binary.LittleEndian); err != nil {
+		o.t.Fatal(err)
+	}
+	decoded, err := dbus.DecodeMessage(&buf)
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	return &dbus.Call{Body: decoded.Body}
+}
+
+// fakeStatusBus stands in for the system bus with the given objects by name.
+type fakeStatusBus struct {
+	objects map[string]statusObject
+	matches int
+	signals chan<- *dbus.Signal
+}
+
+func (b *fakeStatusBus) Object(dest string, path dbus.ObjectPath) dbus.BusObject {
+	return b.objects[dest]
+}
+
+func (b *fakeStatusBus) AddMatchSignal(options ...dbus.MatchOption) error {
+	b.matches++
+	return nil
+}
+
+func (b *fakeStatusBus) Signal(ch chan<- *dbus.Signal) {
+	b.signals = ch
+}
+
+func TestReadSyncStatus(t *testing.T) {
+	message := ntpMessage{
+		Version:           4,
+		Mode:              4,
+		Stratum:           3,
+		Reference:         []byte{10, 0, 0, 1},
+		OriginTimestamp:   1_700_000_000_000_000,
+		ReceiveTimestamp:  1_700_000_000_002_000,
+		TransmitTimestamp: 1_700_000_000_002_100,
+		DestTimestamp:     1_700_000_000_000_300,
+		PacketCount:       12,
+	}
+	bus := &fakeStatusBus{objects: map[string]statusObject{
+		timesync1Name: {t: t, properties: map[string]any{
+			"ServerName":       "time.cloudflare.com",
+			"ServerAddress":    ntpAddress{Family: 2, Address: []byte{162, 159, 200, 1}},
+			"NTPMessage":       message,
+			"PollIntervalUSec": uint64(64_000_000),
+		}},
+		timedate1Name: {t: t, properties: map[string]any{"NTPSynchronized": true}},
+	}}
+
+	status := readSyncStatus(bus)
+	expected := syncStatus{
+		serverName:    "time.cloudflare.com",
+		serverAddress: "162.159.200.1",
+		synchronized:  true,
+		lastSyncTime:  1_700_000_000_000_300,
+		offset:        1_900,
+		pollInterval:  64_000_000,
+	}
+	if status != expected {
+		t.Errorf("readSyncStatus() = %+v, want %+v", status, expected)
+	}
+
+	// timesyncd not running yet, nothing can be read
+	bus.objects = map[string]statusObject{
+		timesync1Name: {t: t},
+		timedate1Name: {t: t, properties: map[string]any{"NTPSynchronized": false}},
+	}
+	if status := readSyncStatus(bus); status != (syncStatus{}) {
+		t.Errorf("readSyncStatus() = %+v, want the zero status", status)
+	}
+}
+
+func TestWatchStatusSignals(t *testing.T) {
+	bus := &fakeStatusBus{}
+	updates := make(chan struct{}, 10)
+	if err := watchStatusSignals(bus, func() { updates <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+	if bus.matches != 1 || bus.signals == nil {
+		t.Fatalf("expected the signals to be subscribed, got %d matches", bus.matches)
+	}
+
+	// Only property changes of timesyncd refresh the status
+	bus.signals <- &dbus.Signal{Path: timedate1Path, Name: propertiesIface + ".PropertiesChanged"}
+	bus.signals <- &dbus.Signal{Path: timesync1Path, Name: "org.freedesktop.DBus.NameOwnerChanged"}
+	bus.signals <- &dbus.Signal{Path: timesync1Path, Name: propertiesIface + ".PropertiesChanged"}
+
+	select {
+	case <-updates:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update after timesyncd properties changed")
+	}
+	select {
+	case <-updates:
+		t.Error("unexpected update for an unrelated signal")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNTPMessageOffset(t *testing.T) {
+	message := ntpMessage{
+		OriginTimestamp:   1_000_000,
+		ReceiveTimestamp:  1_250_000,
+		TransmitTimestamp: 1_250_100,
+		DestTimestamp:     1_000_300,
+	}
+	// ((250000) + (249800)) / 2
+	if got := message.offset(); got != 249900 {
+		t.Errorf("offset() = %d, want 249900", got)
+	}
+
+	message = ntpMessage{
+		OriginTimestamp:   2_000_000,
+		ReceiveTimestamp:  1_500_000,
+		TransmitTimestamp: 1_500_000,
+		DestTimestamp:     2_000_000,
+	}
+	if got := message.offset(); got != -500000 {
+		t.Errorf("offset() = %d, want -500000", got)
+	}
+
+	if got := (ntpMessage{}).offset(); got != 0 {
+		t.Errorf("offset() of empty message = %d, want 0", got)
+	}
+}
+
+func TestFormatAddress(t *testing.T) {
+	cases := []struct {
+		address ntpAddress
+		want    string
+	}{
+		{ntpAddress{Family: 2, Address: []byte{162, 159, 200, 1}}, "162.159.200.1"},
+		{ntpAddress{Family: 10, Address: []byte{0x26, 0x06, 0x47, 0x00, 0xf1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01}}, "2606:4700:f100::1"},
+		{ntpAddress{}, ""},
+	}
+	for _, c := range cases {
+		if got := formatAddress(c.address); got != c.want {
+			t.Errorf("formatAddress(%v) = %q, want %q", c.address, got, c.want)
+		}
+	}
+}
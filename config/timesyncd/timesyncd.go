@@ -5,25 +5,45 @@ import (
 	"github.com/godbus/dbus/v5"
 	"github.com/godbus/dbus/v5/introspect"
 	"github.com/godbus/dbus/v5/prop"
-	"github.com/home-assistant/os-agent/utils/lineinfile"
+	"github.com/home-assistant/os-agent/utils/filewatch"
+	"github.com/home-assistant/os-agent/utils/systemd"
+	"net"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
+	"github.com/home-assistant/os-agent/utils/filehistory"
 	logging "github.com/home-assistant/os-agent/utils/log"
+	"github.com/home-assistant/os-agent/utils/settings"
 )
 
 const (
 	objectPath    = "/io/hass/os/Config/Timesyncd"
 	ifaceName     = "io.hass.os.Config.Timesyncd"
-	timesyncdConf = "/etc/systemd/timesyncd.conf"
+	timesyncdUnit = "systemd-timesyncd.service"
 )
 
+var hostnameRegexp = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.?$`)
+
 var (
 	optNTPServer         []string
 	optFallbackNTPServer []string
-	configFile           = lineinfile.LineInFile{FilePath: timesyncdConf}
 )
 
+// intervalOptions are the time span options exposed in seconds, along with
+// the timesyncd default and the smallest accepted value.
+var intervalOptions = map[string]struct {
+	defaultValue uint32
+	min          uint32
+}{
+	"RootDistanceMaxSec": {defaultValue: 5, min: 1},
+	"PollIntervalMinSec": {defaultValue: 32, min: 16},
+	"PollIntervalMaxSec": {defaultValue: 2048, min: 16},
+	"SaveIntervalSec":    {defaultValue: 60, min: 1},
+}
+
 type timesyncd struct {
 	conn  *dbus.Conn
 	props *prop.Properties
@@ -37,12 +57,38 @@ func getFallbackNTPServers() []string {
 	return getTimesyncdConfigProperty("FallbackNTP")
 }
 
+// validateServers checks that every entry is a hostname or IP address and
+// that no server is listed twice.
+func validateServers(servers []string) error {
+	seen := map[string]bool{}
+	for _, server := range servers {
+		if server == "" {
+			return fmt.Errorf("empty NTP server entry")
+		}
+		if net.ParseIP(server) == nil && (len(server) > 253 || !hostnameRegexp.MatchString(server)) {
+			return fmt.Errorf("invalid NTP server %q", server)
+		}
+
+		key := strings.ToLower(strings.TrimSuffix(server, "."))
+		if seen[key] {
+			return fmt.Errorf("duplicate NTP server %q", server)
+		}
+		seen[key] = true
+	}
+
+	return nil
+}
+
 func setNTPServer(c *prop.Change) *dbus.Error {
 	servers, ok := c.Value.([]string)
 	if !ok {
 		return dbus.MakeFailedError(fmt.Errorf("invalid type for NTPServer"))
 	}
 
+	if err := validateServers(servers); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
 	value := strings.Join(servers, " ")
 
 	if err := setTimesyncdConfigProperty("NTP", value); err != nil {
@@ -59,6 +105,10 @@ func setFallbackNTPServer(c *prop.Change) *dbus.Error {
 		return dbus.MakeFailedError(fmt.Errorf("invalid type for FallbackNTPServer"))
 	}
 
+	if err := validateServers(servers); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
 	value := strings.Join(servers, " ")
 
 	if err := setTimesyncdConfigProperty("FallbackNTP", value); err != nil {
@@ -70,34 +120,167 @@ func setFallbackNTPServer(c *prop.Change) *dbus.Error {
 }
 
 func getTimesyncdConfigProperty(property string) []string {
-	value, err := configFile.Find(`^\s*(`+property+`=).*$`, `\[Time\]`, true)
+	value, _ := getConfigOption(property)
+	return strings.Fields(value)
+}
 
-	var servers []string
+func setTimesyncdConfigProperty(property string, value string) error {
+	return setConfigOption(property, value)
+}
 
-	if err != nil || value == nil {
-		return servers
+// getIntervalOption returns the effective value of a time span option in
+// seconds, falling back to the timesyncd default.
+func getIntervalOption(name string) uint32 {
+	option := intervalOptions[name]
+
+	value, ok := getConfigOption(name)
+	if !ok || value == "" {
+		return option.defaultValue
 	}
 
-	matches := regexp.MustCompile(property + `=([^\s#]+(?:\s+[^\s#]+)*)`).FindStringSubmatch(*value)
-	if len(matches) > 1 {
-		servers = strings.Split(matches[1], " ")
+	seconds, err := parseTimespan(value)
+	if err != nil {
+		logging.Warning.Printf("Ignoring invalid %s in timesyncd configuration: %s", name, err)
+		return option.defaultValue
 	}
 
-	return servers
+	return seconds
 }
 
-func setTimesyncdConfigProperty(property string, value string) error {
-	var params = lineinfile.NewPresentParams(property + "=" + value)
-	params.Regexp, _ = regexp.Compile(`^\s*#?\s*(` + property + `=).*$`)
-	// Keep it simple, timesyncd.conf only has the [Time] section
-	params.After = `\[Time\]`
-	if err := configFile.Present(params); err != nil {
-		return fmt.Errorf("failed to set %s: %w", property, err)
+// validateInterval checks a time span option against its minimum and the
+// poll interval bounds against each other. other returns the value of the
+// opposite bound.
+func validateInterval(name string, seconds uint32, other func(name string) uint32) error {
+	if seconds < intervalOptions[name].min {
+		return fmt.Errorf("%s must be at least %d", name, intervalOptions[name].min)
+	}
+	if name == "PollIntervalMinSec" && seconds > other("PollIntervalMaxSec") {
+		return fmt.Errorf("PollIntervalMinSec must not exceed PollIntervalMaxSec")
+	}
+	if name == "PollIntervalMaxSec" && seconds < other("PollIntervalMinSec") {
+		return fmt.Errorf("PollIntervalMaxSec must not be below PollIntervalMinSec")
 	}
 
 	return nil
 }
 
+// validate checks new values for the writable properties, used to validate
+// all changes of a transaction before any of them is written. The poll
+// interval bounds are checked against the new value of the other bound if it
+// is changed as well.
+func validate(changes map[string]any) error {
+	other := func(name string) uint32 {
+		if value, ok := changes[name].(uint32); ok {
+			return value
+		}
+		return getIntervalOption(name)
+	}
+
+	for name, value := range changes {
+		var err error
+		switch name {
+		case "NTPServer", "FallbackNTPServer":
+			err = validateServers(value.([]string))
+		case "RootDistanceMaxSec", "PollIntervalMinSec", "PollIntervalMaxSec", "SaveIntervalSec":
+			err = validateInterval(name, value.(uint32), other)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setIntervalOption(name string) func(c *prop.Change) *dbus.Error {
+	return func(c *prop.Change) *dbus.Error {
+		seconds, ok := c.Value.(uint32)
+		if !ok {
+			return dbus.MakeFailedError(fmt.Errorf("%s must be uint32, got %T", name, c.Value))
+		}
+
+		if err := validateInterval(name, seconds, getIntervalOption); err != nil {
+			return dbus.MakeFailedError(err)
+		}
+
+		if err := setConfigOption(name, strconv.FormatUint(uint64(seconds), 10)); err != nil {
+			return dbus.MakeFailedError(err)
+		}
+
+		logging.Info.Printf("Set timesyncd %s to %d", name, seconds)
+		return nil
+	}
+}
+
+// refreshConfig re-reads the effective configuration after a configuration
+// file was changed. It runs on the watcher goroutine, so it only updates the
+// properties and leaves the package variables to the property callbacks.
+func (d timesyncd) refreshConfig() {
+	values := map[string]any{
+		"NTPServer":         getNTPServers(),
+		"FallbackNTPServer": getFallbackNTPServers(),
+	}
+	for name := range intervalOptions {
+		values[name] = getIntervalOption(name)
+	}
+
+	if settings.Refresh(d.props, ifaceName, values) {
+		logging.Info.Printf("Refreshed timesyncd configuration after external change")
+	}
+}
+
+// watchConfig refreshes the properties when timesyncd.conf or any of its
+// drop-ins is edited by hand or replaced by an OS update. The agent's drop-in
+// directory is created up front, other directories which don't exist are not
+// watched.
+func (d timesyncd) watchConfig() {
+	if err := os.MkdirAll(dropInDir, 0o755); err != nil { //nolint:gosec
+		logging.Warning.Printf("Failed to create %s: %s", dropInDir, err)
+	}
+
+	for _, root := range configRoots {
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		if err := filewatch.Watch(filepath.Join(root, configName), d.refreshConfig); err != nil {
+			logging.Warning.Printf("Failed to watch %s: %s", filepath.Join(root, configName), err)
+		}
+
+		dir := filepath.Join(root, configName+".d")
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := filewatch.WatchDir(dir, d.refreshConfig); err != nil {
+			logging.Warning.Printf("Failed to watch %s: %s", dir, err)
+		}
+	}
+}
+
+// Apply restarts timesyncd so changed servers are used right away.
+func (d timesyncd) Apply() *dbus.Error {
+	if err := systemd.RestartUnit(timesyncdUnit); err != nil {
+		return dbus.MakeFailedError(fmt.Errorf("failed to restart %s: %w", timesyncdUnit, err))
+	}
+
+	logging.Info.Printf("Restarted %s to apply new configuration", timesyncdUnit)
+	return nil
+}
+
+// TestNTPServer queries the given server once and returns the offset of the
+// local clock in microseconds.
+func (d timesyncd) TestNTPServer(host string) (int64, *dbus.Error) {
+	if err := validateServers([]string{host}); err != nil {
+		return 0, dbus.MakeFailedError(err)
+	}
+
+	offset, err := sntpQuery(net.JoinHostPort(host, ntpPort), sntpTimeout)
+	if err != nil {
+		return 0, dbus.MakeFailedError(fmt.Errorf("NTP query to %s failed: %w", host, err))
+	}
+
+	return offset.Microseconds(), nil
+}
+
 func InitializeDBus(conn *dbus.Conn) {
 	d := timesyncd{
 		conn: conn,
@@ -105,6 +288,7 @@ func InitializeDBus(conn *dbus.Conn) {
 
 	optNTPServer = getNTPServers()
 	optFallbackNTPServer = getFallbackNTPServers()
+	status := readSyncStatus(conn)
 
 	propsSpec := map[string]map[string]*prop.Prop{
 		ifaceName: {
@@ -120,6 +304,66 @@ func InitializeDBus(conn *dbus.Conn) {
 				Emit:     prop.EmitTrue,
 				Callback: setFallbackNTPServer,
 			},
+			"RootDistanceMaxSec": {
+				Value:    getIntervalOption("RootDistanceMaxSec"),
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: setIntervalOption("RootDistanceMaxSec"),
+			},
+			"PollIntervalMinSec": {
+				Value:    getIntervalOption("PollIntervalMinSec"),
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: setIntervalOption("PollIntervalMinSec"),
+			},
+			"PollIntervalMaxSec": {
+				Value:    getIntervalOption("PollIntervalMaxSec"),
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: setIntervalOption("PollIntervalMaxSec"),
+			},
+			"SaveIntervalSec": {
+				Value:    getIntervalOption("SaveIntervalSec"),
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: setIntervalOption("SaveIntervalSec"),
+			},
+			"ServerName": {
+				Value:    status.serverName,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"ServerAddress": {
+				Value:    status.serverAddress,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"Synchronized": {
+				Value:    status.synchronized,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"LastSyncTime": {
+				Value:    status.lastSyncTime,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"Offset": {
+				Value:    status.offset,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"PollInterval": {
+				Value:    status.pollInterval,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
 		},
 	}
 
@@ -128,6 +372,13 @@ func InitializeDBus(conn *dbus.Conn) {
 		logging.Critical.Panic(err)
 	}
 	d.props = props
+	files := []string{configFile.FilePath}
+	settings.Register(ifaceName, props, []string{"NTPServer", "FallbackNTPServer", "RootDistanceMaxSec", "PollIntervalMinSec", "PollIntervalMaxSec", "SaveIntervalSec"}, files, validate)
+
+	err = filehistory.ExportProperties(conn, objectPath, props, files)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
 
 	err = conn.Export(d, objectPath, ifaceName)
 	if err != nil {
@@ -153,4 +404,7 @@ func InitializeDBus(conn *dbus.Conn) {
 	}
 
 	logging.Info.Printf("Exposing object %s with interface %s ...", objectPath, ifaceName)
+
+	d.watchSyncStatus()
+	d.watchConfig()
 }
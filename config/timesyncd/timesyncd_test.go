@@ -0,0 +1,194 @@
+package timesyncd
+
+import (
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/home-assistant/os-agent/utils/settings"
+)
+
+// callbackProperties runs the property callbacks like prop.Properties does,
+// without exporting the properties on a bus.
+type callbackProperties struct {
+	values    map[string]any
+	callbacks map[string]func(c *prop.Change) *dbus.Error
+}
+
+func (p callbackProperties) Get(iface string, property string) (dbus.Variant, *dbus.Error) {
+	return dbus.MakeVariant(p.values[property]), nil
+}
+
+func (p callbackProperties) Set(iface string, property string, value dbus.Variant) *dbus.Error {
+	if err := p.callbacks[property](&prop.Change{Iface: iface, Name: property, Value: value.Value()}); err != nil {
+		return err
+	}
+	p.values[property] = value.Value()
+	return nil
+}
+
+func TestValidateServers(t *testing.T) {
+	valid := [][]string{
+		{},
+		{"time.cloudflare.com"},
+		{"0.home-assistant.pool.ntp.org", "ntp.example.com."},
+		{"192.168.1.1", "2001:db8::1"},
+		{"localhost"},
+	}
+	for _, servers := range valid {
+		if err := validateServers(servers); err != nil {
+			t.Errorf("validateServers(%q) failed: %s", servers, err)
+		}
+	}
+
+	invalid := [][]string{
+		{""},
+		{"ntp.example.com", ""},
+		{"ntp example.com"},
+		{"ntp.example.com\nFallbackNTP=evil"},
+		{"-ntp.example.com"},
+		{"ntp_example.com"},
+		{"ntp.example.com", "NTP.example.com"},
+		{"192.168.1.1", "192.168.1.1"},
+	}
+	for _, servers := range invalid {
+		if err := validateServers(servers); err == nil {
+			t.Errorf("validateServers(%q) expected an error", servers)
+		}
+	}
+}
+
+func TestValidateInterval(t *testing.T) {
+	bounds := func(name string) uint32 {
+		return map[string]uint32{"PollIntervalMinSec": 32, "PollIntervalMaxSec": 2048}[name]
+	}
+
+	if err := validateInterval("PollIntervalMinSec", 64, bounds); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := validateInterval("PollIntervalMinSec", 8, bounds); err == nil {
+		t.Errorf("expected an error below the minimum")
+	}
+	if err := validateInterval("PollIntervalMinSec", 4096, bounds); err == nil {
+		t.Errorf("expected an error above PollIntervalMaxSec")
+	}
+	if err := validateInterval("PollIntervalMaxSec", 16, bounds); err == nil {
+		t.Errorf("expected an error below PollIntervalMinSec")
+	}
+
+	// Both bounds raised in one transaction are checked against each other
+	changes := map[string]any{"PollIntervalMinSec": uint32(4096), "PollIntervalMaxSec": uint32(8192)}
+	if err := validate(changes); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	changes = map[string]any{"PollIntervalMinSec": uint32(4096), "PollIntervalMaxSec": uint32(1024)}
+	if err := validate(changes); err == nil {
+		t.Errorf("expected an error for crossed bounds")
+	}
+}
+
+func TestNTPTimeRoundTrip(t *testing.T) {
+	now := time.Unix(1700000000, 123456789)
+	got := fromNTPTime(toNTPTime(now))
+	if diff := got.Sub(now); diff < -time.Microsecond || diff > time.Microsecond {
+		t.Errorf("round trip of %s returned %s", now, got)
+	}
+}
+
+// serveNTP answers a single SNTP request, reporting a clock shifted by skew.
+func serveNTP(t *testing.T, skew time.Duration, stratum byte) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		request := make([]byte, ntpPacketSize)
+		n, addr, err := conn.ReadFrom(request)
+		if err != nil || n < ntpPacketSize {
+			return
+		}
+
+		response := make([]byte, ntpPacketSize)
+		response[0] = 0x24 // version 4, mode 4 (server)
+		response[1] = stratum
+		copy(response[12:16], "DENY")
+		copy(response[24:32], request[40:48])
+		now := toNTPTime(time.Now().Add(skew))
+		binary.BigEndian.PutUint64(response[32:], now)
+		binary.BigEndian.PutUint64(response[40:], now)
+		_, _ = conn.WriteTo(response, addr)
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestSNTPQuery(t *testing.T) {
+	address := serveNTP(t, 10*time.Second, 2)
+
+	offset, err := sntpQuery(address, time.Second)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	if offset < 9*time.Second || offset > 11*time.Second {
+		t.Errorf("unexpected offset %s", offset)
+	}
+}
+
+func TestSNTPQueryKissOfDeath(t *testing.T) {
+	address := serveNTP(t, 0, 0)
+
+	if _, err := sntpQuery(address, time.Second); err == nil {
+		t.Errorf("expected kiss-o'-death response to be rejected")
+	}
+}
+
+func TestSNTPQueryTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer conn.Close()
+
+	if _, err := sntpQuery(conn.LocalAddr().String(), 100*time.Millisecond); err == nil {
+		t.Errorf("expected query without response to time out")
+	}
+}
+
+func TestApplyPollIntervals(t *testing.T) {
+	path := useDropIn(t)
+	previousRoots := configRoots
+	configRoots = []string{filepath.Dir(filepath.Dir(path))}
+	t.Cleanup(func() { configRoots = previousRoots })
+
+	props := callbackProperties{
+		values: map[string]any{"PollIntervalMinSec": uint32(32), "PollIntervalMaxSec": uint32(2048)},
+		callbacks: map[string]func(c *prop.Change) *dbus.Error{
+			"PollIntervalMinSec": setIntervalOption("PollIntervalMinSec"),
+			"PollIntervalMaxSec": setIntervalOption("PollIntervalMaxSec"),
+		},
+	}
+	settings.Register(ifaceName, props, []string{"PollIntervalMinSec", "PollIntervalMaxSec"}, []string{path}, validate)
+
+	// Lowering and raising both bounds past the current other one
+	for _, bounds := range [][2]uint32{{16, 24}, {4096, 8192}} {
+		err := settings.Apply([]settings.Change{
+			{Interface: ifaceName, Property: "PollIntervalMinSec", Value: dbus.MakeVariant(bounds[0])},
+			{Interface: ifaceName, Property: "PollIntervalMaxSec", Value: dbus.MakeVariant(bounds[1])},
+		})
+		if err != nil {
+			t.Fatalf("failed to apply %v: %s", bounds, err)
+		}
+		if minSec, maxSec := getIntervalOption("PollIntervalMinSec"), getIntervalOption("PollIntervalMaxSec"); minSec != bounds[0] || maxSec != bounds[1] {
+			t.Errorf("expected bounds %v, got %d and %d", bounds, minSec, maxSec)
+		}
+	}
+}
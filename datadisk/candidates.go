@@ -0,0 +1,136 @@
+package datadisk
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/home-assistant/os-agent/udisks2"
+)
+
+// candidateDevice is the (ssssstbbas) description of a disk which could hold
+// the data partition. Reasons explains why a disk is not eligible.
+type candidateDevice struct {
+	Device        string
+	Vendor        string
+	Model         string
+	Serial        string
+	ConnectionBus string
+	Size          uint64
+	Removable     bool
+	Eligible      bool
+	Reasons       []string
+}
+
+// evaluateCandidate checks whether the data partition can be moved to disk.
+// dataDevice is the disk currently holding the data partition, dataUsed the
+// space used on it. Leftover Home Assistant OS partitions, e.g. of a former
+// data disk, only block the move unless force is set.
+func evaluateCandidate(disk udisks2.DiskInfo, dataDevice string, dataUsed uint64, force bool) candidateDevice {
+	reasons := []string{}
+
+	if disk.Size == 0 {
+		reasons = append(reasons, "no medium")
+	} else if disk.Size < dataUsed {
+		reasons = append(reasons, fmt.Sprintf("too small, %d bytes of data need to be moved", dataUsed))
+	}
+	if slices.Contains(disk.Labels, labelBoot) {
+		reasons = append(reasons, "is the boot disk")
+	}
+	if slices.Contains(disk.MountPoints, "/") {
+		reasons = append(reasons, "hosts the root file system")
+	}
+	if disk.Device == dataDevice {
+		reasons = append(reasons, "is the current data disk")
+	}
+	if len(disk.MountPoints) > 0 {
+		reasons = append(reasons, "currently mounted")
+	}
+	if disk.ReadOnly {
+		reasons = append(reasons, "read-only")
+	}
+	if !force && !slices.Contains(disk.Labels, labelBoot) && disk.Device != dataDevice {
+		for _, label := range disk.Labels {
+			if strings.HasPrefix(label, "hassos-") {
+				reasons = append(reasons, fmt.Sprintf("contains a Home Assistant OS partition (%s)", label))
+			}
+		}
+	}
+
+	return candidateDevice{
+		Device:        disk.Device,
+		Vendor:        disk.Vendor,
+		Model:         disk.Model,
+		Serial:        disk.Serial,
+		ConnectionBus: disk.ConnectionBus,
+		Size:          disk.Size,
+		Removable:     disk.Removable,
+		Eligible:      len(reasons) == 0,
+		Reasons:       reasons,
+	}
+}
+
+// dataUsage returns the space used on the data partition.
+func dataUsage() (uint64, error) {
+	usage, err := readDiskUsage(dataMount)
+	if err != nil {
+		return 0, err
+	}
+	return usage.Used, nil
+}
+
+func listCandidates(helper udisks2.UDisks2Helper, force bool) ([]candidateDevice, error) {
+	disks, err := helper.ListDisks()
+	if err != nil {
+		return nil, err
+	}
+
+	dataDevice := ""
+	if device, err := helper.GetRootDeviceFromLabel(labelData); err == nil {
+		dataDevice = *device
+	}
+	dataUsed, err := dataUsage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine data usage: %w", err)
+	}
+
+	candidates := make([]candidateDevice, 0, len(disks))
+	for _, disk := range disks {
+		candidates = append(candidates, evaluateCandidate(disk, dataDevice, dataUsed, force))
+	}
+
+	return candidates, nil
+}
+
+// checkTarget runs the pre-flight checks for moving the data partition to
+// device and returns its description. Symlinks like /dev/disk/by-id paths
+// are resolved to the disk they point to.
+func checkTarget(helper udisks2.UDisks2Helper, device string, force bool) (candidateDevice, error) {
+	candidates, err := listCandidates(helper, force)
+	if err != nil {
+		return candidateDevice{}, err
+	}
+
+	return findTarget(candidates, device)
+}
+
+// findTarget returns the candidate device resolves to.
+func findTarget(candidates []candidateDevice, device string) (candidateDevice, error) {
+	resolved, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return candidateDevice{}, fmt.Errorf("device %s not found: %w", device, err)
+	}
+
+	for _, candidate := range candidates {
+		if candidate.Device != resolved {
+			continue
+		}
+		if !candidate.Eligible {
+			return candidate, fmt.Errorf("can't move data to %s: %s", device, strings.Join(candidate.Reasons, ", "))
+		}
+		return candidate, nil
+	}
+
+	return candidateDevice{}, fmt.Errorf("device %s not found or not a whole disk", device)
+}
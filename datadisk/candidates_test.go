@@ -0,0 +1,118 @@
+package datadisk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/home-assistant/os-agent/udisks2"
+)
+
+func TestEvaluateCandidate(t *testing.T) {
+	const gib = 1 << 30
+
+	tests := []struct {
+		name    string
+		disk    udisks2.DiskInfo
+		reasons []string
+	}{
+		{
+			name:    "eligible",
+			disk:    udisks2.DiskInfo{Device: "/dev/sda", Size: 256 * gib},
+			reasons: []string{},
+		},
+		{
+			name:    "no medium",
+			disk:    udisks2.DiskInfo{Device: "/dev/sdb"},
+			reasons: []string{"no medium"},
+		},
+		{
+			name:    "boot disk",
+			disk:    udisks2.DiskInfo{Device: "/dev/mmcblk0", Size: 32 * gib, Labels: []string{labelBoot, "hassos-overlay"}, MountPoints: []string{"/mnt/boot"}},
+			reasons: []string{"is the boot disk", "currently mounted"},
+		},
+		{
+			name:    "root disk",
+			disk:    udisks2.DiskInfo{Device: "/dev/sdd", Size: 32 * gib, MountPoints: []string{"/"}},
+			reasons: []string{"hosts the root file system", "currently mounted"},
+		},
+		{
+			name:    "former data disk",
+			disk:    udisks2.DiskInfo{Device: "/dev/sde", Size: 64 * gib, Labels: []string{"hassos-data-old"}},
+			reasons: []string{"contains a Home Assistant OS partition (hassos-data-old)"},
+		},
+		{
+			name:    "current data disk",
+			disk:    udisks2.DiskInfo{Device: "/dev/nvme0n1", Size: 512 * gib},
+			reasons: []string{"is the current data disk"},
+		},
+		{
+			name:    "small read-only",
+			disk:    udisks2.DiskInfo{Device: "/dev/sdc", Size: 4 * gib, ReadOnly: true},
+			reasons: []string{"too small, 8589934592 bytes of data need to be moved", "read-only"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidate := evaluateCandidate(tt.disk, "/dev/nvme0n1", 8*gib, false)
+			if candidate.Eligible != (len(tt.reasons) == 0) {
+				t.Errorf("unexpected eligibility %t", candidate.Eligible)
+			}
+			if len(candidate.Reasons) != len(tt.reasons) {
+				t.Fatalf("expected reasons %q, got %q", tt.reasons, candidate.Reasons)
+			}
+			for i := range tt.reasons {
+				if candidate.Reasons[i] != tt.reasons[i] {
+					t.Errorf("expected reasons %q, got %q", tt.reasons, candidate.Reasons)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateCandidateForce(t *testing.T) {
+	disk := udisks2.DiskInfo{Device: "/dev/sde", Size: 64 << 30, Labels: []string{"hassos-data-old"}}
+	if candidate := evaluateCandidate(disk, "/dev/nvme0n1", 0, true); !candidate.Eligible {
+		t.Errorf("expected force to allow leftover partitions, got %q", candidate.Reasons)
+	}
+
+	// Force never allows moving onto the boot disk
+	disk = udisks2.DiskInfo{Device: "/dev/mmcblk0", Size: 64 << 30, Labels: []string{labelBoot}}
+	if candidate := evaluateCandidate(disk, "/dev/nvme0n1", 0, true); candidate.Eligible {
+		t.Error("expected the boot disk to be rejected with force")
+	}
+}
+
+func TestFindTarget(t *testing.T) {
+	dev := t.TempDir()
+	disk := filepath.Join(dev, "sda")
+	if err := os.WriteFile(disk, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	byID := filepath.Join(dev, "disk", "by-id", "usb-Samsung_Flash_Drive_0123456789-0:0")
+	if err := os.MkdirAll(filepath.Dir(byID), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../sda", byID); err != nil {
+		t.Fatal(err)
+	}
+
+	candidates := []candidateDevice{
+		{Device: filepath.Join(dev, "mmcblk0"), Reasons: []string{"is the boot disk"}},
+		{Device: disk, Eligible: true, Reasons: []string{}},
+	}
+	for _, device := range []string{disk, byID} {
+		target, err := findTarget(candidates, device)
+		if err != nil {
+			t.Fatalf("%s: %s", device, err)
+		}
+		if target.Device != disk {
+			t.Errorf("%s: expected %s, got %s", device, disk, target.Device)
+		}
+	}
+
+	if _, err := findTarget(candidates, filepath.Join(dev, "disk", "by-id", "missing")); err == nil {
+		t.Error("expected error for a missing device")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/fntlnz/mountinfo"
 	"github.com/godbus/dbus/v5"
@@ -11,12 +12,21 @@ import (
 	"github.com/godbus/dbus/v5/prop"
 
 	"github.com/home-assistant/os-agent/udisks2"
+	"github.com/home-assistant/os-agent/utils/filehistory"
 	logging "github.com/home-assistant/os-agent/utils/log"
+	"github.com/home-assistant/os-agent/utils/settings"
 )
 
 const (
 	dataMount              = "/mnt/data"
 	linuxDataPartitionUUID = "0FC63DAF-8483-4772-8E79-3D69D8477DE4"
+	labelBoot              = "hassos-boot"
+	labelData              = "hassos-data"
+	externalPartitionName  = "hassos-data-external"
+	// UDisks might not have probed the data partition yet when the agent
+	// starts on boot
+	resolveAttempts = 5
+	resolveDelay    = 2 * time.Second
 )
 
 func GetDataMount() (*mountinfo.Mountinfo, error) {
@@ -42,46 +52,338 @@ type datadisk struct {
 
 func (d datadisk) MarkDataMove() *dbus.Error {
 	/* Move request marker for hassos-data.service */
-	fileName := "/mnt/overlay/move-data"
-	_, err := os.Stat(fileName)
+	_, err := os.Stat(moveMarker)
 	if os.IsNotExist(err) {
-		file, err := os.Create(fileName)
+		file, err := os.Create(moveMarker)
 		if err != nil {
 			return dbus.MakeFailedError(err)
 		}
 		defer file.Close()
 	}
 
+	d.props.SetMust(ifaceName, "DataMovePending", true)
 	return nil
 }
 
-func (d datadisk) ChangeDevice(newDevice string) (bool, *dbus.Error) {
-	logging.Info.Printf("Request to change data disk to %s.", newDevice)
+// CancelDataMove removes a pending data move. With restoreTable the
+// previous partition table of the target is written back, provided nothing
+// changed the target since it was prepared. For moves back to the boot disk
+// the prepared partition is deleted, or renamed back if it was reused.
+func (d datadisk) CancelDataMove(restoreTable bool) *dbus.Error {
+	if _, err := os.Stat(moveMarker); os.IsNotExist(err) {
+		return dbus.MakeFailedError(errors.New("no data move pending"))
+	}
 
+	var state moveState
+	hasState, err := readJSON(statePath(), &state)
+	if err != nil {
+		return dbus.MakeFailedError(fmt.Errorf("failed to read data move state: %w", err))
+	}
 	udisks2helper := udisks2.NewUDisks2(d.conn)
-	dataDevice, err := udisks2helper.GetRootDeviceFromLabel("hassos-data")
+	if restoreTable {
+		bootDevice, err := udisks2helper.GetRootDeviceFromLabel(labelBoot)
+		if err != nil {
+			return dbus.MakeFailedError(fmt.Errorf("failed to determine the boot disk: %w", err))
+		}
+		if err := checkRestore(state, hasState, *bootDevice); err != nil {
+			return dbus.MakeFailedError(err)
+		}
+	}
+
+	if err := os.Remove(moveMarker); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	logging.Info.Printf("Data move to %s cancelled.", state.Target)
+
+	var restoreErr error
+	switch {
+	case restoreTable && state.Internal:
+		if err := undoInternalPartition(udisks2helper, state); err != nil {
+			restoreErr = fmt.Errorf("data move cancelled, but the partition prepared on the boot disk was not reverted: %w", err)
+		}
+	case restoreTable:
+		if err := restorePartitionTable(state.Target, tableBackupPath(), state.Fingerprint); err != nil {
+			restoreErr = fmt.Errorf("data move cancelled, but the partition table was not restored: %w", err)
+		} else {
+			logging.Info.Printf("Restored previous partition table of %s.", state.Target)
+			if err := udisks2helper.RescanDevice(state.Target); err != nil {
+				restoreErr = fmt.Errorf("partition table restored, but %s was not rescanned, reboot to apply: %w", state.Target, err)
+			}
+		}
+	}
+
+	d.finishMove(state, moveCancelled)
+
+	if restoreErr != nil {
+		return dbus.MakeFailedError(restoreErr)
+	}
+	return nil
+}
+
+// finishMove records the outcome of a move and updates the properties.
+func (d datadisk) finishMove(state moveState, outcome string) {
+	result, err := finishMove(state, outcome)
 	if err != nil {
-		return false, dbus.MakeFailedError(err)
+		logging.Warning.Printf("Failed to record data move outcome: %s", err)
+	}
+
+	d.props.SetMust(ifaceName, "DataMovePending", false)
+	d.props.SetMust(ifaceName, "PendingTargetDevice", "")
+	d.props.SetMust(ifaceName, "LastMoveOutcome", result.Outcome)
+	d.props.SetMust(ifaceName, "LastMoveTarget", result.Target)
+	d.props.SetMust(ifaceName, "LastMoveTime", result.Time)
+}
+
+// changeDevice prepares newDevice to receive the data partition on the next
+// boot and returns the steps taken, or only the steps which would be taken
+// with dryRun.
+func (d datadisk) changeDevice(newDevice string, force bool, dryRun bool) ([]string, error) {
+	udisks2helper := udisks2.NewUDisks2(d.conn)
+	dataDevice, err := udisks2helper.GetRootDeviceFromLabel(labelData)
+	if err != nil {
+		return nil, err
 	}
 
 	logging.Info.Printf("Data partition is currently on device %s.", *dataDevice)
-	if *dataDevice == newDevice {
-		return false, dbus.MakeFailedError(fmt.Errorf("current data device \"%s\" the same as target device", *dataDevice))
+
+	target, err := checkTarget(udisks2helper, newDevice, force)
+	if err != nil {
+		return nil, err
+	}
+	if *dataDevice == target.Device {
+		return nil, fmt.Errorf("current data device \"%s\" the same as target device", *dataDevice)
+	}
+	// Continue with the kernel name of the disk, not a symlink to it
+	newDevice = target.Device
+
+	steps := []string{
+		fmt.Sprintf("Create a GPT partition table on %s (%s %s, %d bytes), erasing all data on it", newDevice, target.Vendor, target.Model, target.Size),
+		fmt.Sprintf("Create partition %s spanning %s", externalPartitionName, newDevice),
+		fmt.Sprintf("Move the data partition from %s to %s on the next boot", *dataDevice, newDevice),
+	}
+	if dryRun {
+		return steps, nil
+	}
+
+	err = d.prepareMove(newMoveState(*dataDevice, newDevice), func() error {
+		return udisks2helper.PartitionDeviceWithSinglePartition(newDevice, linuxDataPartitionUUID, externalPartitionName)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return steps, nil
+}
+
+// prepareMove partitions the target of state with the given function and
+// marks the data move. The previous partition table of external targets is
+// kept so the move can be cancelled.
+func (d datadisk) prepareMove(state moveState, partition func() error) error {
+	target := state.Target
+	if !state.Internal {
+		if err := backupPartitionTable(target, tableBackupPath()); err != nil {
+			return fmt.Errorf("failed to back up partition table of %s: %w", target, err)
+		}
+	}
+
+	if err := partition(); err != nil {
+		return err
+	}
+
+	if uuid, err := preparedPartitionUUID(udisks2.NewUDisks2(d.conn), target); err == nil {
+		state.PartitionUUID = uuid
+	} else {
+		logging.Warning.Printf("Failed to identify the partition prepared on %s: %s", target, err)
+	}
+	if !state.Internal {
+		if regions, err := readTableRegions(target); err == nil {
+			state.Fingerprint = fingerprint(regions)
+		} else {
+			logging.Warning.Printf("Failed to read new partition table of %s: %s", target, err)
+		}
+	}
+	if err := writeJSON(statePath(), state); err != nil {
+		logging.Warning.Printf("Failed to save data move state: %s", err)
+	}
+
+	if dbuserr := d.MarkDataMove(); dbuserr != nil {
+		return dbuserr
+	}
+	d.props.SetMust(ifaceName, "PendingTargetDevice", target)
+
+	return nil
+}
+
+// preparedPartitionUUID returns the partition UUID of the partition prepared
+// on target to receive the data.
+func preparedPartitionUUID(udisks2helper udisks2.UDisks2Helper, target string) (string, error) {
+	partitions, err := udisks2helper.ListPartitions(target)
+	if err != nil {
+		return "", err
+	}
+	for _, partition := range partitions {
+		if partition.Name == externalPartitionName && partition.UUID != "" {
+			return partition.UUID, nil
+		}
+	}
+	return "", fmt.Errorf("no partition %s found", externalPartitionName)
+}
+
+// undoInternalPartition reverts the partition prepared on the boot disk by
+// RevertToInternal through UDisks: a created partition is deleted, a reused
+// one gets its former name back.
+func undoInternalPartition(udisks2helper udisks2.UDisks2Helper, state moveState) error {
+	partitions, err := udisks2helper.ListPartitions(state.Target)
+	if err != nil {
+		return err
+	}
+	partition, err := preparedPartition(state, partitions)
+	if err != nil {
+		return err
+	}
+
+	if state.Reused {
+		logging.Info.Printf("Renaming partition %s back to %s.", partition.Device, labelData)
+		return udisks2helper.SetPartitionTypeAndName(partition.Device, linuxDataPartitionUUID, labelData)
+	}
+	return udisks2helper.DeletePartition(partition.Device)
+}
+
+// dataPartitionUUID returns the partition UUID of the data partition, or an
+// empty string if it could not be resolved.
+func dataPartitionUUID(udisks2helper udisks2.UDisks2Helper) string {
+	for attempt := 1; ; attempt++ {
+		uuid, err := udisks2helper.GetPartitionUUIDFromLabel(labelData)
+		if err == nil {
+			return uuid
+		}
+		if attempt == resolveAttempts {
+			logging.Warning.Printf("Failed to resolve the data partition: %s", err)
+			return ""
+		}
+		time.Sleep(resolveDelay)
+	}
+}
+
+// RevertToInternal moves the data partition back to the boot disk on the
+// next boot. The former internal data partition is reused if it still
+// exists, otherwise a partition is created in the free space of the disk.
+func (d datadisk) RevertToInternal() (bool, *dbus.Error) {
+	logging.Info.Print("Request to move data disk back to internal storage.")
+
+	udisks2helper := udisks2.NewUDisks2(d.conn)
+	dataDevice, err := udisks2helper.GetRootDeviceFromLabel(labelData)
+	if err != nil {
+		return false, dbus.MakeFailedError(err)
+	}
+	bootDevice, err := udisks2helper.GetRootDeviceFromLabel(labelBoot)
+	if err != nil {
+		return false, dbus.MakeFailedError(err)
+	}
+	if *dataDevice == *bootDevice {
+		return false, dbus.MakeFailedError(fmt.Errorf("data partition is already on the boot disk %s", *bootDevice))
+	}
+	if _, err := os.Stat(moveMarker); err == nil {
+		return false, dbus.MakeFailedError(errors.New("a data move is already pending"))
+	}
+
+	disks, err := udisks2helper.ListDisks()
+	if err != nil {
+		return false, dbus.MakeFailedError(err)
+	}
+	var bootDisk *udisks2.DiskInfo
+	for i := range disks {
+		if disks[i].Device == *bootDevice {
+			bootDisk = &disks[i]
+		}
+	}
+	if bootDisk == nil {
+		return false, dbus.MakeFailedError(fmt.Errorf("boot disk %s not found", *bootDevice))
+	}
+	if bootDisk.ReadOnly {
+		return false, dbus.MakeFailedError(fmt.Errorf("boot disk %s is read-only", *bootDevice))
+	}
+
+	partitions, err := udisks2helper.ListPartitions(*bootDevice)
+	if err != nil {
+		return false, dbus.MakeFailedError(err)
+	}
+	dataUsed, err := dataUsage()
+	if err != nil {
+		return false, dbus.MakeFailedError(fmt.Errorf("failed to determine data usage: %w", err))
+	}
+	plan, err := planInternalPartition(bootDisk.Size, partitions, dataUsed)
+	if err != nil {
+		return false, dbus.MakeFailedError(err)
 	}
 
-	err = udisks2helper.PartitionDeviceWithSinglePartition(newDevice, linuxDataPartitionUUID, "hassos-data-external")
+	state := newMoveState(*dataDevice, *bootDevice)
+	state.Internal = true
+	state.Reused = plan.Reuse != ""
+	err = d.prepareMove(state, func() error {
+		if plan.Reuse != "" {
+			logging.Info.Printf("Reusing former data partition %s.", plan.Reuse)
+			return udisks2helper.SetPartitionTypeAndName(plan.Reuse, linuxDataPartitionUUID, externalPartitionName)
+		}
+		return udisks2helper.CreatePartition(*bootDevice, plan.Offset, plan.Size, linuxDataPartitionUUID, externalPartitionName)
+	})
 	if err != nil {
 		return false, dbus.MakeFailedError(err)
 	}
 
-	dbuserr := d.MarkDataMove()
-	if dbuserr != nil {
-		return false, dbuserr
+	return true, nil
+}
+
+func (d datadisk) ChangeDevice(newDevice string) (bool, *dbus.Error) {
+	logging.Info.Printf("Request to change data disk to %s.", newDevice)
+
+	if _, err := d.changeDevice(newDevice, false, false); err != nil {
+		return false, dbus.MakeFailedError(err)
 	}
 
 	return true, nil
 }
 
+// ChangeDeviceWithOptions is ChangeDevice with options: "Force" (b) allows
+// targets with leftover Home Assistant OS partitions, "DryRun" (b) only runs
+// the checks. Returns the steps taken, or which would be taken on a dry run.
+func (d datadisk) ChangeDeviceWithOptions(newDevice string, options map[string]dbus.Variant) ([]string, *dbus.Error) {
+	force, dryRun := false, false
+	for name, value := range options {
+		flag, ok := value.Value().(bool)
+		switch {
+		case name != "Force" && name != "DryRun":
+			return nil, dbus.MakeFailedError(fmt.Errorf("unknown option %q", name))
+		case !ok:
+			return nil, dbus.MakeFailedError(fmt.Errorf("option %q must be a boolean", name))
+		case name == "Force":
+			force = flag
+		default:
+			dryRun = flag
+		}
+	}
+
+	logging.Info.Printf("Request to change data disk to %s (force: %t, dry run: %t).", newDevice, force, dryRun)
+
+	steps, err := d.changeDevice(newDevice, force, dryRun)
+	if err != nil {
+		return nil, dbus.MakeFailedError(err)
+	}
+
+	return steps, nil
+}
+
+// ListCandidateDevices returns all disks along with whether the data
+// partition can be moved to them, and the reasons if not.
+func (d datadisk) ListCandidateDevices() ([]candidateDevice, *dbus.Error) {
+	candidates, err := listCandidates(udisks2.NewUDisks2(d.conn), false)
+	if err != nil {
+		return nil, dbus.MakeFailedError(err)
+	}
+
+	return candidates, nil
+}
+
 func (d datadisk) ReloadDevice() (bool, *dbus.Error) {
 	mountInfo, err := GetDataMount()
 	if err != nil {
@@ -112,6 +414,40 @@ func InitializeDBus(conn *dbus.Conn) {
 		conn: conn,
 	}
 
+	// A move requested before the last boot has been attempted once its
+	// marker is gone
+	_, markerErr := os.Stat(moveMarker)
+	dataMovePending := markerErr == nil
+	var state moveState
+	hasState, err := readJSON(statePath(), &state)
+	if err != nil {
+		logging.Warning.Printf("Failed to read data move state: %s", err)
+	}
+	if hasState && !dataMovePending {
+		outcome := moveOutcome(state, dataPartitionUUID(udisks2.NewUDisks2(conn)))
+		if _, err := finishMove(state, outcome); err != nil {
+			logging.Warning.Printf("Failed to record data move outcome: %s", err)
+		}
+		logging.Info.Printf("Data move from %s to %s %s.", state.Source, state.Target, outcome)
+	}
+	pendingTarget := ""
+	if hasState && dataMovePending {
+		pendingTarget = state.Target
+	}
+	var lastMove moveResult
+	if _, err := readJSON(resultPath(), &lastMove); err != nil {
+		logging.Warning.Printf("Failed to read last data move outcome: %s", err)
+	}
+
+	loadThresholds()
+	lowSpaceLevel := spaceOK
+	usage, err := readDiskUsage(dataMount)
+	if err != nil {
+		logging.Warning.Printf("Failed to read data disk usage: %s", err)
+	} else {
+		lowSpaceLevel = spaceLevel(usage.Free, thresholds)
+	}
+
 	propsSpec := map[string]map[string]*prop.Prop{
 		ifaceName: {
 			"CurrentDevice": {
@@ -120,6 +456,78 @@ func InitializeDBus(conn *dbus.Conn) {
 				Emit:     prop.EmitTrue,
 				Callback: nil,
 			},
+			"DataMovePending": {
+				Value:    dataMovePending,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"PendingTargetDevice": {
+				Value:    pendingTarget,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"LastMoveOutcome": {
+				Value:    lastMove.Outcome,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"LastMoveTarget": {
+				Value:    lastMove.Target,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"LastMoveTime": {
+				Value:    lastMove.Time,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"TotalBytes": {
+				Value:    usage.Total,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"UsedBytes": {
+				Value:    usage.Used,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"FreeBytes": {
+				Value:    usage.Free,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"InodesFree": {
+				Value:    usage.InodesFree,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"LowSpaceLevel": {
+				Value:    lowSpaceLevel,
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"LowSpaceWarningBytes": {
+				Value:    thresholds.Warning,
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: setLowSpaceWarning,
+			},
+			"LowSpaceCriticalBytes": {
+				Value:    thresholds.Critical,
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: setLowSpaceCritical,
+			},
 		},
 	}
 	props, err := prop.Export(conn, objectPath, propsSpec)
@@ -127,6 +535,13 @@ func InitializeDBus(conn *dbus.Conn) {
 		logging.Critical.Panic(err)
 	}
 	d.props = props
+	files := []string{thresholdsPath()}
+	settings.Register(ifaceName, props, []string{"LowSpaceWarningBytes", "LowSpaceCriticalBytes"}, files, validateLowSpace)
+
+	err = filehistory.ExportProperties(conn, objectPath, props, files)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
 
 	err = conn.Export(d, objectPath, ifaceName)
 	if err != nil {
@@ -142,6 +557,20 @@ func InitializeDBus(conn *dbus.Conn) {
 				Name:       ifaceName,
 				Methods:    introspect.Methods(d),
 				Properties: props.Introspection(ifaceName),
+				Signals: []introspect.Signal{
+					{
+						Name: "LowSpace",
+						Args: []introspect.Arg{{Name: "level", Type: "s"}},
+					},
+					{
+						Name: "DeviceAdded",
+						Args: []introspect.Arg{{Name: "device", Type: "(ssssstbbas)"}},
+					},
+					{
+						Name: "DeviceRemoved",
+						Args: []introspect.Arg{{Name: "device", Type: "(ssssstbbas)"}},
+					},
+				},
 			},
 		},
 	}
@@ -152,4 +581,14 @@ func InitializeDBus(conn *dbus.Conn) {
 	}
 
 	logging.Info.Printf("Exposing object %s with interface %s ...", objectPath, ifaceName)
+
+	d.watchDevices()
+	initializeHealth(conn)
+	initializeWear(conn)
+
+	go func() {
+		for range time.Tick(usageRefreshInterval) {
+			d.updateUsage()
+		}
+	}()
 }
@@ -0,0 +1,362 @@
+package datadisk
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/home-assistant/os-agent/udisks2"
+	logging "github.com/home-assistant/os-agent/utils/log"
+	"github.com/home-assistant/os-agent/utils/settings"
+)
+
+const (
+	healthObjectPath = "/io/hass/os/DataDisk/Health"
+	healthIfaceName  = "io.hass.os.DataDisk.Health"
+
+	healthRefreshInterval = time.Minute
+
+	// nvmeWearWarning is the estimated percentage of the NVMe drive's life
+	// used up from which on its health is a warning
+	nvmeWearWarning = 90
+
+	smartReallocatedSectors = 5
+	smartPendingSectors     = 197
+)
+
+// Health verdicts of the data drive.
+const (
+	healthUnknown = "unknown"
+	healthGood    = "good"
+	healthWarning = "warning"
+	healthFailing = "failing"
+)
+
+// selfTestTypes are the self-test types of ATA and NVMe drives, the drive
+// rejects types it doesn't support.
+var selfTestTypes = []string{"short", "extended", "conveyance", "offline", "vendor-specific"}
+
+// nvmeFailingWarnings are the NVMe critical warnings indicating the drive
+// is failing, the remaining ones ("temperature", "pmr_readonly") are only a
+// warning.
+var nvmeFailingWarnings = []string{"spare", "degraded", "readonly", "volatile_mem"}
+
+// healthAttribute is the (ysiiixsb) description of a SMART attribute.
+type healthAttribute struct {
+	ID        byte
+	Name      string
+	Value     int32
+	Worst     int32
+	Threshold int32
+	Pretty    int64
+	Unit      string
+	Failing   bool
+}
+
+// healthReport is the health of the data drive independent of its type.
+// Counters the drive doesn't report are -1.
+type healthReport struct {
+	Device  string
+	Verdict string
+	Failing bool
+	// Updated is the time the drive was last queried in seconds since the
+	// epoch
+	Updated uint64
+	// Temperature in degrees Celsius, 0 if unknown
+	Temperature              float64
+	PowerOnHours             uint64
+	ReallocatedSectors       int64
+	PendingSectors           int64
+	BadSectors               int64
+	SelfTestStatus           string
+	SelfTestPercentRemaining int32
+	// Attributes are the SMART attributes of ATA drives
+	Attributes []healthAttribute
+	// CriticalWarnings, PercentageUsed, MediaErrors and DataWritten (in
+	// bytes) are reported by NVMe drives
+	CriticalWarnings []string
+	PercentageUsed   int32
+	MediaErrors      int64
+	DataWritten      int64
+}
+
+type health struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+}
+
+func unknownHealth(device string) healthReport {
+	return healthReport{
+		Device:                   device,
+		Verdict:                  healthUnknown,
+		ReallocatedSectors:       -1,
+		PendingSectors:           -1,
+		BadSectors:               -1,
+		SelfTestStatus:           "",
+		SelfTestPercentRemaining: -1,
+		Attributes:               []healthAttribute{},
+		CriticalWarnings:         []string{},
+		PercentageUsed:           -1,
+		MediaErrors:              -1,
+		DataWritten:              -1,
+	}
+}
+
+// ataReport interprets the SMART data of an ATA drive. Any failing attribute
+// or reallocated, pending or bad sector is a warning.
+func ataReport(device string, ata udisks2.AtaHealth) healthReport {
+	report := unknownHealth(device)
+	if !ata.Enabled {
+		return report
+	}
+
+	report.Failing = ata.Failing
+	report.Updated = ata.Updated
+	report.PowerOnHours = ata.PowerOnSeconds / 3600
+	report.BadSectors = ata.NumBadSectors
+	report.SelfTestStatus = ata.SelftestStatus
+	report.SelfTestPercentRemaining = ata.SelftestPercentRemaining
+	if ata.Temperature > 0 {
+		report.Temperature = ata.Temperature - 273.15
+	}
+
+	for _, attribute := range ata.Attributes {
+		report.Attributes = append(report.Attributes, healthAttribute{
+			ID:        attribute.ID,
+			Name:      attribute.Name,
+			Value:     attribute.Value,
+			Worst:     attribute.Worst,
+			Threshold: attribute.Threshold,
+			Pretty:    attribute.Pretty,
+			Unit:      attribute.Unit,
+			Failing:   attribute.Threshold > 0 && attribute.Value > 0 && attribute.Value <= attribute.Threshold,
+		})
+		switch attribute.ID {
+		case smartReallocatedSectors:
+			report.ReallocatedSectors = attribute.Pretty
+		case smartPendingSectors:
+			report.PendingSectors = attribute.Pretty
+		}
+	}
+
+	switch {
+	case ata.Failing:
+		report.Verdict = healthFailing
+	case ata.NumAttributesFailing > 0 || report.ReallocatedSectors > 0 || report.PendingSectors > 0 || report.BadSectors > 0:
+		report.Verdict = healthWarning
+	default:
+		report.Verdict = healthGood
+	}
+
+	return report
+}
+
+// nvmeReport interprets the SMART/health information of an NVMe drive.
+// Critical warnings other than the temperature ones mean the drive is
+// failing, media errors or a worn out drive are a warning.
+func nvmeReport(device string, nvme udisks2.NvmeHealth) healthReport {
+	report := unknownHealth(device)
+
+	report.Updated = nvme.Updated
+	report.PowerOnHours = nvme.PowerOnHours
+	report.SelfTestStatus = nvme.SelftestStatus
+	report.SelfTestPercentRemaining = nvme.SelftestPercentRemaining
+	if nvme.Temperature > 0 {
+		report.Temperature = float64(nvme.Temperature) - 273.15
+	}
+	if nvme.CriticalWarnings != nil {
+		report.CriticalWarnings = nvme.CriticalWarnings
+	}
+	report.PercentageUsed = int32(nvme.PercentUsed)
+	report.MediaErrors = int64(nvme.MediaErrors)  //nolint:gosec
+	report.DataWritten = int64(nvme.BytesWritten) //nolint:gosec
+
+	for _, warning := range report.CriticalWarnings {
+		if slices.Contains(nvmeFailingWarnings, warning) {
+			report.Failing = true
+		}
+	}
+
+	switch {
+	case report.Failing:
+		report.Verdict = healthFailing
+	case len(report.CriticalWarnings) > 0 || report.MediaErrors > 0 || report.PercentageUsed >= nvmeWearWarning:
+		report.Verdict = healthWarning
+	default:
+		report.Verdict = healthGood
+	}
+
+	return report
+}
+
+// dataDrive returns the disk currently holding the data partition.
+func dataDrive(helper udisks2.UDisks2Helper) (string, error) {
+	device, err := helper.GetRootDeviceFromLabel(labelData)
+	if err != nil {
+		return "", err
+	}
+	return *device, nil
+}
+
+func readHealth(helper udisks2.UDisks2Helper) healthReport {
+	device, err := dataDrive(helper)
+	if err != nil {
+		logging.Warning.Printf("Failed to determine data drive: %s", err)
+		return unknownHealth("")
+	}
+
+	ata, err := helper.GetAtaHealth(device)
+	if err == nil {
+		return ataReport(device, ata)
+	} else if !errors.Is(err, udisks2.ErrHealthUnsupported) {
+		logging.Warning.Printf("Failed to read health of %s: %s", device, err)
+		return unknownHealth(device)
+	}
+
+	nvme, err := helper.GetNvmeHealth(device)
+	if err == nil {
+		return nvmeReport(device, nvme)
+	} else if !errors.Is(err, udisks2.ErrHealthUnsupported) {
+		logging.Warning.Printf("Failed to read health of %s: %s", device, err)
+	}
+
+	return unknownHealth(device)
+}
+
+func (r healthReport) values() map[string]any {
+	return map[string]any{
+		"Device":                   r.Device,
+		"Verdict":                  r.Verdict,
+		"Failing":                  r.Failing,
+		"Updated":                  r.Updated,
+		"Temperature":              r.Temperature,
+		"PowerOnHours":             r.PowerOnHours,
+		"ReallocatedSectors":       r.ReallocatedSectors,
+		"PendingSectors":           r.PendingSectors,
+		"BadSectors":               r.BadSectors,
+		"SelfTestStatus":           r.SelfTestStatus,
+		"SelfTestPercentRemaining": r.SelfTestPercentRemaining,
+		"Attributes":               r.Attributes,
+		"CriticalWarnings":         r.CriticalWarnings,
+		"PercentageUsed":           r.PercentageUsed,
+		"MediaErrors":              r.MediaErrors,
+		"DataWritten":              r.DataWritten,
+	}
+}
+
+// refresh re-reads the health of the data drive, signals are only emitted
+// for values which actually changed.
+func (h health) refresh() {
+	report := readHealth(udisks2.NewUDisks2(h.conn))
+	if settings.Refresh(h.props, healthIfaceName, report.values()) && report.Verdict != healthGood {
+		logging.Info.Printf("Health of data drive %s is %s.", report.Device, report.Verdict)
+	}
+}
+
+// StartSelfTest starts a self-test of the data drive, type is one of
+// "short", "extended", "conveyance" or "offline" for ATA drives and "short",
+// "extended" or "vendor-specific" for NVMe drives.
+func (h health) StartSelfTest(testType string) *dbus.Error {
+	if !slices.Contains(selfTestTypes, testType) {
+		return dbus.MakeFailedError(fmt.Errorf("unknown self-test type %q", testType))
+	}
+
+	helper := udisks2.NewUDisks2(h.conn)
+	device, err := dataDrive(helper)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	err = helper.StartAtaSelfTest(device, testType)
+	if errors.Is(err, udisks2.ErrHealthUnsupported) {
+		err = helper.StartNvmeSelfTest(device, testType)
+	}
+	if err != nil {
+		return dbus.MakeFailedError(fmt.Errorf("failed to start self-test on %s: %w", device, err))
+	}
+	logging.Info.Printf("Started %s self-test on %s.", testType, device)
+
+	h.refresh()
+	return nil
+}
+
+// AbortSelfTest aborts the running self-test of the data drive.
+func (h health) AbortSelfTest() *dbus.Error {
+	helper := udisks2.NewUDisks2(h.conn)
+	device, err := dataDrive(helper)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	err = helper.AbortAtaSelfTest(device)
+	if errors.Is(err, udisks2.ErrHealthUnsupported) {
+		err = helper.AbortNvmeSelfTest(device)
+	}
+	if err != nil {
+		return dbus.MakeFailedError(fmt.Errorf("failed to abort self-test on %s: %w", device, err))
+	}
+	logging.Info.Printf("Aborted self-test on %s.", device)
+
+	h.refresh()
+	return nil
+}
+
+func initializeHealth(conn *dbus.Conn) {
+	h := health{
+		conn: conn,
+	}
+
+	propsSpec := map[string]map[string]*prop.Prop{
+		healthIfaceName: {},
+	}
+	for name, value := range readHealth(udisks2.NewUDisks2(conn)).values() {
+		propsSpec[healthIfaceName][name] = &prop.Prop{
+			Value:    value,
+			Writable: false,
+			Emit:     prop.EmitTrue,
+			Callback: nil,
+		}
+	}
+
+	props, err := prop.Export(conn, healthObjectPath, propsSpec)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+	h.props = props
+
+	err = conn.Export(h, healthObjectPath, healthIfaceName)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	node := &introspect.Node{
+		Name: healthObjectPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       healthIfaceName,
+				Methods:    introspect.Methods(h),
+				Properties: props.Introspection(healthIfaceName),
+			},
+		},
+	}
+
+	err = conn.Export(introspect.NewIntrospectable(node), healthObjectPath, "org.freedesktop.DBus.Introspectable")
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	logging.Info.Printf("Exposing object %s with interface %s ...", healthObjectPath, healthIfaceName)
+
+	go func() {
+		for range time.Tick(healthRefreshInterval) {
+			h.refresh()
+		}
+	}()
+}
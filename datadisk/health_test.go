@@ -0,0 +1,105 @@
+package datadisk
+
+import (
+	"testing"
+
+	"github.com/home-assistant/os-agent/udisks2"
+)
+
+func TestAtaReport(t *testing.T) {
+	healthy := udisks2.AtaHealth{
+		Enabled:                  true,
+		PowerOnSeconds:           7200,
+		Temperature:              313.15,
+		NumBadSectors:            0,
+		SelftestStatus:           "success",
+		SelftestPercentRemaining: -1,
+		Attributes: []udisks2.SmartAttribute{
+			{ID: 5, Name: "reallocated-sector-count", Value: 100, Worst: 100, Threshold: 10, Pretty: 0, Unit: "sectors"},
+			{ID: 197, Name: "current-pending-sector", Value: 100, Worst: 100, Threshold: 0, Pretty: 0, Unit: "sectors"},
+		},
+	}
+
+	report := ataReport("/dev/sda", healthy)
+	if report.Verdict != healthGood {
+		t.Errorf("expected %s, got %s", healthGood, report.Verdict)
+	}
+	if report.PowerOnHours != 2 || report.ReallocatedSectors != 0 || report.PendingSectors != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if report.Temperature < 39.99 || report.Temperature > 40.01 {
+		t.Errorf("expected 40 degrees Celsius, got %f", report.Temperature)
+	}
+	if len(report.Attributes) != 2 || report.Attributes[0].Failing {
+		t.Errorf("unexpected attributes %+v", report.Attributes)
+	}
+
+	reallocated := healthy
+	reallocated.Attributes = []udisks2.SmartAttribute{
+		{ID: 5, Name: "reallocated-sector-count", Value: 5, Worst: 5, Threshold: 10, Pretty: 240, Unit: "sectors"},
+	}
+	reallocated.NumAttributesFailing = 1
+	report = ataReport("/dev/sda", reallocated)
+	if report.Verdict != healthWarning || report.ReallocatedSectors != 240 || report.PendingSectors != -1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if !report.Attributes[0].Failing {
+		t.Error("expected attribute below threshold to be failing")
+	}
+
+	failing := healthy
+	failing.Failing = true
+	if report := ataReport("/dev/sda", failing); report.Verdict != healthFailing {
+		t.Errorf("expected %s, got %s", healthFailing, report.Verdict)
+	}
+
+	if report := ataReport("/dev/sda", udisks2.AtaHealth{}); report.Verdict != healthUnknown || report.BadSectors != -1 {
+		t.Errorf("expected unknown health with SMART disabled, got %+v", report)
+	}
+}
+
+func TestNvmeReport(t *testing.T) {
+	healthy := udisks2.NvmeHealth{
+		State:                    "live",
+		PowerOnHours:             1200,
+		Temperature:              318,
+		SelftestStatus:           "success",
+		SelftestPercentRemaining: -1,
+		PercentUsed:              3,
+		AvailableSpare:           100,
+		SpareThreshold:           10,
+		BytesWritten:             12 << 40,
+	}
+
+	report := nvmeReport("/dev/nvme0n1", healthy)
+	if report.Verdict != healthGood || report.Failing {
+		t.Errorf("expected %s, got %s", healthGood, report.Verdict)
+	}
+	if report.PowerOnHours != 1200 || report.PercentageUsed != 3 || report.MediaErrors != 0 || report.DataWritten != 12<<40 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if report.Temperature < 44.84 || report.Temperature > 44.86 {
+		t.Errorf("expected 44.85 degrees Celsius, got %f", report.Temperature)
+	}
+	if report.CriticalWarnings == nil || report.ReallocatedSectors != -1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	worn := healthy
+	worn.PercentUsed = 95
+	if report := nvmeReport("/dev/nvme0n1", worn); report.Verdict != healthWarning {
+		t.Errorf("expected %s for worn drive, got %s", healthWarning, report.Verdict)
+	}
+
+	hot := healthy
+	hot.CriticalWarnings = []string{"temperature"}
+	if report := nvmeReport("/dev/nvme0n1", hot); report.Verdict != healthWarning || report.Failing {
+		t.Errorf("expected %s for temperature warning, got %s", healthWarning, report.Verdict)
+	}
+
+	degraded := healthy
+	degraded.CriticalWarnings = []string{"degraded"}
+	if report := nvmeReport("/dev/nvme0n1", degraded); report.Verdict != healthFailing || !report.Failing {
+		t.Errorf("expected %s for degraded drive, got %s", healthFailing, report.Verdict)
+	}
+}
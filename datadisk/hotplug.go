@@ -0,0 +1,155 @@
+package datadisk
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/home-assistant/os-agent/udisks2"
+	logging "github.com/home-assistant/os-agent/utils/log"
+)
+
+const (
+	udisks2Path        = "/org/freedesktop/UDisks2"
+	objectManagerIface = "org.freedesktop.DBus.ObjectManager"
+
+	// hotplugDelay groups the UDisks2 signals of a single device change,
+	// e.g. a disk appearing along with its partitions
+	hotplugDelay = 500 * time.Millisecond
+)
+
+var (
+	// knownCandidates are the candidate devices when last listed, keyed by
+	// device.
+	knownCandidates = map[string]candidateDevice{}
+	hotplugMu       sync.Mutex
+	hotplugTimer    *time.Timer
+)
+
+// diffCandidates returns the devices which appeared in and disappeared from
+// the current candidate list, in the order of the respective list.
+func diffCandidates(previous map[string]candidateDevice, current []candidateDevice) ([]candidateDevice, []candidateDevice) {
+	added := []candidateDevice{}
+	seen := map[string]bool{}
+	for _, candidate := range current {
+		seen[candidate.Device] = true
+		if _, ok := previous[candidate.Device]; !ok {
+			added = append(added, candidate)
+		}
+	}
+
+	removed := []candidateDevice{}
+	for device, candidate := range previous {
+		if !seen[device] {
+			removed = append(removed, candidate)
+		}
+	}
+
+	return added, removed
+}
+
+// isDeviceObject reports whether a UDisks2 object describes a block device
+// or drive, other objects like jobs come and go with every operation.
+func isDeviceObject(path dbus.ObjectPath) bool {
+	return strings.HasPrefix(string(path), udisks2Path+"/block_devices/") ||
+		strings.HasPrefix(string(path), udisks2Path+"/drives/")
+}
+
+// refreshCurrentDevice updates CurrentDevice from the data mount.
+func (d datadisk) refreshCurrentDevice() {
+	mountInfo, err := GetDataMount()
+	if err != nil {
+		return
+	}
+
+	if d.props.GetMust(ifaceName, "CurrentDevice").(string) != mountInfo.MountSource {
+		logging.Info.Printf("Data partition is now on %s.", mountInfo.MountSource)
+		d.props.SetMust(ifaceName, "CurrentDevice", mountInfo.MountSource)
+	}
+}
+
+// refreshCandidates lists the candidate devices and emits DeviceAdded and
+// DeviceRemoved for the changes since they were last listed.
+func (d datadisk) refreshCandidates() {
+	candidates, err := listCandidates(udisks2.NewUDisks2(d.conn), false)
+	if err != nil {
+		logging.Warning.Printf("Failed to list candidate devices: %s", err)
+		return
+	}
+
+	hotplugMu.Lock()
+	added, removed := diffCandidates(knownCandidates, candidates)
+	knownCandidates = map[string]candidateDevice{}
+	for _, candidate := range candidates {
+		knownCandidates[candidate.Device] = candidate
+	}
+	hotplugMu.Unlock()
+
+	for _, candidate := range removed {
+		logging.Info.Printf("Device %s removed.", candidate.Device)
+		if err := d.conn.Emit(objectPath, ifaceName+".DeviceRemoved", candidate); err != nil {
+			logging.Warning.Printf("Failed to emit DeviceRemoved signal: %s", err)
+		}
+	}
+	for _, candidate := range added {
+		logging.Info.Printf("Device %s added (%s %s, eligible: %t).", candidate.Device, candidate.Vendor, candidate.Model, candidate.Eligible)
+		if err := d.conn.Emit(objectPath, ifaceName+".DeviceAdded", candidate); err != nil {
+			logging.Warning.Printf("Failed to emit DeviceAdded signal: %s", err)
+		}
+	}
+}
+
+// scheduleRefresh refreshes the devices once the signals of a change settled.
+func (d datadisk) scheduleRefresh() {
+	hotplugMu.Lock()
+	defer hotplugMu.Unlock()
+
+	if hotplugTimer != nil {
+		hotplugTimer.Reset(hotplugDelay)
+		return
+	}
+	hotplugTimer = time.AfterFunc(hotplugDelay, func() {
+		d.refreshCandidates()
+		d.refreshCurrentDevice()
+	})
+}
+
+// watchDevices follows block devices appearing and disappearing through the
+// UDisks2 object manager.
+func (d datadisk) watchDevices() {
+	candidates, err := listCandidates(udisks2.NewUDisks2(d.conn), false)
+	if err != nil {
+		logging.Warning.Printf("Failed to list candidate devices: %s", err)
+	}
+	hotplugMu.Lock()
+	for _, candidate := range candidates {
+		knownCandidates[candidate.Device] = candidate
+	}
+	hotplugMu.Unlock()
+
+	err = d.conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(udisks2Path),
+		dbus.WithMatchInterface(objectManagerIface),
+	)
+	if err != nil {
+		logging.Error.Printf("Failed to watch block devices: %s", err)
+		return
+	}
+
+	signals := make(chan *dbus.Signal, 10)
+	d.conn.Signal(signals)
+
+	go func() {
+		for signal := range signals {
+			if signal.Path != udisks2Path || len(signal.Body) == 0 ||
+				signal.Name != objectManagerIface+".InterfacesAdded" && signal.Name != objectManagerIface+".InterfacesRemoved" {
+				continue
+			}
+			if path, ok := signal.Body[0].(dbus.ObjectPath); ok && isDeviceObject(path) {
+				d.scheduleRefresh()
+			}
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+package datadisk
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestDiffCandidates(t *testing.T) {
+	previous := map[string]candidateDevice{
+		"/dev/mmcblk0": {Device: "/dev/mmcblk0"},
+		"/dev/sda":     {Device: "/dev/sda", Model: "Old"},
+	}
+	current := []candidateDevice{
+		{Device: "/dev/mmcblk0"},
+		{Device: "/dev/sdb", Model: "New"},
+	}
+
+	added, removed := diffCandidates(previous, current)
+	if len(added) != 1 || added[0].Device != "/dev/sdb" || added[0].Model != "New" {
+		t.Errorf("unexpected added devices %+v", added)
+	}
+	if len(removed) != 1 || removed[0].Device != "/dev/sda" || removed[0].Model != "Old" {
+		t.Errorf("unexpected removed devices %+v", removed)
+	}
+
+	added, removed = diffCandidates(map[string]candidateDevice{}, nil)
+	if len(added) != 0 || len(removed) != 0 {
+		t.Errorf("expected no changes, got %+v and %+v", added, removed)
+	}
+}
+
+func TestIsDeviceObject(t *testing.T) {
+	tests := map[dbus.ObjectPath]bool{
+		"/org/freedesktop/UDisks2/block_devices/sda":  true,
+		"/org/freedesktop/UDisks2/block_devices/sda1": true,
+		"/org/freedesktop/UDisks2/drives/Disk_123":    true,
+		"/org/freedesktop/UDisks2/jobs/42":            false,
+		"/org/freedesktop/UDisks2/Manager":            false,
+	}
+
+	for path, expected := range tests {
+		if isDeviceObject(path) != expected {
+			t.Errorf("%s: expected %t", path, expected)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package datadisk
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/home-assistant/os-agent/udisks2"
+)
+
+// partitionAlignment is the alignment of partitions created on the boot disk,
+// it also keeps the area of the primary and backup GPT free.
+const partitionAlignment = 1 << 20
+
+// internalPlan describes how the data partition is prepared on the boot disk.
+// Either an existing partition is reused, or a new one gets created.
+type internalPlan struct {
+	// Reuse is the device of the former internal data partition
+	Reuse  string
+	Offset uint64
+	Size   uint64
+}
+
+func alignUp(value uint64) uint64 {
+	return (value + partitionAlignment - 1) / partitionAlignment * partitionAlignment
+}
+
+func alignDown(value uint64) uint64 {
+	return value / partitionAlignment * partitionAlignment
+}
+
+// largestFreeRegion returns the largest aligned region of a disk which is not
+// covered by partitions.
+func largestFreeRegion(diskSize uint64, partitions []udisks2.PartitionInfo) (uint64, uint64) {
+	sorted := append([]udisks2.PartitionInfo{}, partitions...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
+
+	var bestOffset, bestSize uint64
+	check := func(start uint64, end uint64) {
+		start, end = alignUp(start), alignDown(end)
+		if end > start && end-start > bestSize {
+			bestOffset, bestSize = start, end-start
+		}
+	}
+
+	position := uint64(partitionAlignment)
+	for _, partition := range sorted {
+		if partition.Offset > position {
+			check(position, partition.Offset)
+		}
+		position = max(position, partition.Offset+partition.Size)
+	}
+	if diskSize > partitionAlignment {
+		check(position, diskSize-partitionAlignment)
+	}
+
+	return bestOffset, bestSize
+}
+
+// checkFormerPartition checks whether the former internal data partition can
+// take the data again, its content gets overwritten by the move.
+func checkFormerPartition(partition udisks2.PartitionInfo, dataUsed uint64) error {
+	reasons := []string{}
+
+	if !strings.EqualFold(partition.Type, linuxDataPartitionUUID) {
+		reasons = append(reasons, fmt.Sprintf("not a Linux data partition (%s)", partition.Type))
+	}
+	if len(partition.MountPoints) > 0 {
+		reasons = append(reasons, "currently mounted")
+	}
+	if partition.Size < dataUsed {
+		reasons = append(reasons, fmt.Sprintf("too small, %d bytes of data need to be moved", dataUsed))
+	}
+
+	if len(reasons) > 0 {
+		return fmt.Errorf("can't reuse former data partition %s: %s", partition.Device, strings.Join(reasons, ", "))
+	}
+	return nil
+}
+
+// planInternalPartition determines where the data partition can be placed on
+// the boot disk. The former internal data partition, still carrying the
+// hassos-data name, is reused if present and passes the checks, otherwise the
+// largest free region is used.
+func planInternalPartition(diskSize uint64, partitions []udisks2.PartitionInfo, dataUsed uint64) (internalPlan, error) {
+	for _, partition := range partitions {
+		if partition.Name == externalPartitionName {
+			return internalPlan{}, fmt.Errorf("boot disk already has a partition %s (%s)", externalPartitionName, partition.Device)
+		}
+	}
+
+	for _, partition := range partitions {
+		if partition.Name != labelData {
+			continue
+		}
+		if err := checkFormerPartition(partition, dataUsed); err != nil {
+			return internalPlan{}, err
+		}
+		return internalPlan{Reuse: partition.Device, Offset: partition.Offset, Size: partition.Size}, nil
+	}
+
+	offset, size := largestFreeRegion(diskSize, partitions)
+	if size == 0 {
+		return internalPlan{}, errors.New("no free space on the boot disk")
+	}
+	if size < dataUsed {
+		return internalPlan{}, fmt.Errorf("not enough free space on the boot disk, %d bytes of data need to be moved but only %d bytes are available", dataUsed, size)
+	}
+
+	return internalPlan{Offset: offset, Size: size}, nil
+}
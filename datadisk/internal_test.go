@@ -0,0 +1,113 @@
+package datadisk
+
+import (
+	"testing"
+
+	"github.com/home-assistant/os-agent/udisks2"
+)
+
+func TestLargestFreeRegion(t *testing.T) {
+	const mib = 1 << 20
+
+	tests := []struct {
+		name       string
+		diskSize   uint64
+		partitions []udisks2.PartitionInfo
+		offset     uint64
+		size       uint64
+	}{
+		{
+			name:     "empty disk",
+			diskSize: 100 * mib,
+			offset:   mib,
+			size:     98 * mib,
+		},
+		{
+			name:     "space at the end",
+			diskSize: 100 * mib,
+			partitions: []udisks2.PartitionInfo{
+				{Offset: mib, Size: 40 * mib},
+			},
+			offset: 41 * mib,
+			size:   58 * mib,
+		},
+		{
+			name:     "gap between partitions, unaligned",
+			diskSize: 100 * mib,
+			partitions: []udisks2.PartitionInfo{
+				{Offset: 70 * mib, Size: 29 * mib},
+				{Offset: mib, Size: 10*mib + 512},
+			},
+			offset: 12 * mib,
+			size:   58 * mib,
+		},
+		{
+			name:     "full disk",
+			diskSize: 100 * mib,
+			partitions: []udisks2.PartitionInfo{
+				{Offset: mib, Size: 98 * mib},
+			},
+			offset: 0,
+			size:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, size := largestFreeRegion(tt.diskSize, tt.partitions)
+			if offset != tt.offset || size != tt.size {
+				t.Errorf("expected region at %d with %d bytes, got %d with %d bytes", tt.offset, tt.size, offset, size)
+			}
+		})
+	}
+}
+
+func TestPlanInternalPartition(t *testing.T) {
+	const gib = 1 << 30
+
+	system := []udisks2.PartitionInfo{
+		{Device: "/dev/mmcblk0p1", Name: "hassos-boot", Offset: 1 << 20, Size: gib},
+		{Device: "/dev/mmcblk0p8", Name: "hassos-overlay", Offset: gib + 1<<20, Size: gib},
+	}
+
+	plan, err := planInternalPartition(32*gib, system, 10*gib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Reuse != "" || plan.Offset != 2*gib+1<<20 || plan.Size != 30*gib-2<<20 {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+
+	if _, err := planInternalPartition(32*gib, system, 31*gib); err == nil {
+		t.Error("expected error for insufficient free space")
+	}
+
+	former := append(append([]udisks2.PartitionInfo{}, system...),
+		udisks2.PartitionInfo{Device: "/dev/mmcblk0p9", Name: labelData, Type: "0fc63daf-8483-4772-8e79-3d69d8477de4", Offset: 2*gib + 1<<20, Size: 30*gib - 2<<20})
+	plan, err = planInternalPartition(32*gib, former, 10*gib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Reuse != "/dev/mmcblk0p9" {
+		t.Errorf("expected former data partition to be reused, got %+v", plan)
+	}
+
+	// The former data partition is overwritten, so it is checked first
+	for name, modify := range map[string]func(p *udisks2.PartitionInfo){
+		"too small":  func(p *udisks2.PartitionInfo) { p.Size = gib },
+		"mounted":    func(p *udisks2.PartitionInfo) { p.MountPoints = []string{"/mnt/data"} },
+		"wrong type": func(p *udisks2.PartitionInfo) { p.Type = "c12a7328-f81f-11d2-ba4b-00a0c93ec93b" },
+	} {
+		unsuitable := append([]udisks2.PartitionInfo{}, former...)
+		modify(&unsuitable[len(unsuitable)-1])
+		if _, err := planInternalPartition(32*gib, unsuitable, 10*gib); err == nil {
+			t.Errorf("%s: expected former data partition to be refused", name)
+		}
+	}
+
+	prepared := append(append([]udisks2.PartitionInfo{}, system...),
+		udisks2.PartitionInfo{Device: "/dev/mmcblk0p9", Name: externalPartitionName, Offset: 2*gib + 1<<20, Size: gib})
+	if _, err := planInternalPartition(32*gib, prepared, 0); err == nil {
+		t.Error("expected error for already prepared partition")
+	}
+}
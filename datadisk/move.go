@@ -0,0 +1,263 @@
+package datadisk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/natefinch/atomic"
+
+	"github.com/home-assistant/os-agent/udisks2"
+)
+
+const (
+	moveMarker = "/mnt/overlay/move-data"
+	// tableRegionSize covers the partition tables at the start and end of a
+	// disk, both the protective MBR with the primary GPT and the backup GPT.
+	tableRegionSize = 1 << 20
+)
+
+// stateDir keeps the state of data moves across reboots, on the overlay
+// partition so it stays on the boot disk.
+var stateDir = "/mnt/overlay/os-agent"
+
+// Outcomes of a data move.
+const (
+	moveSucceeded = "succeeded"
+	moveFailed    = "failed"
+	moveCancelled = "cancelled"
+	// moveUnknown is the outcome of moves whose data partition could not be
+	// identified.
+	moveUnknown = "unknown"
+)
+
+// moveState describes a data move requested through the agent. It is kept
+// until the move was attempted on boot or cancelled.
+type moveState struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Time   int64  `json:"time"`
+	// Fingerprint of the target's partition table regions after partitioning,
+	// the previous content is kept in the table backup.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// PartitionUUID is the GPT partition UUID of the partition prepared on
+	// the target, kernel names of disks can change between boots.
+	PartitionUUID string `json:"partition_uuid,omitempty"`
+	// Internal is set for moves back to the boot disk, whose partition table
+	// is only changed through UDisks. Reused tells whether the former data
+	// partition was reused rather than a new one created.
+	Internal bool `json:"internal,omitempty"`
+	Reused   bool `json:"reused,omitempty"`
+}
+
+// moveResult is the outcome of the last data move.
+type moveResult struct {
+	moveState
+	Outcome string `json:"outcome"`
+}
+
+func statePath() string {
+	return filepath.Join(stateDir, "data-move.json")
+}
+
+func resultPath() string {
+	return filepath.Join(stateDir, "last-data-move.json")
+}
+
+func tableBackupPath() string {
+	return filepath.Join(stateDir, "data-move-table.bin")
+}
+
+func readJSON(path string, value any) (bool, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(content, value)
+}
+
+func writeJSON(path string, value any) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return atomic.WriteFile(path, bytes.NewReader(content))
+}
+
+// readTableRegions returns the first and last tableRegionSize bytes of a
+// device, concatenated.
+func readTableRegions(device string) ([]byte, error) {
+	f, err := os.Open(device)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if size < 2*tableRegionSize {
+		return nil, fmt.Errorf("device %s is too small", device)
+	}
+
+	regions := make([]byte, 2*tableRegionSize)
+	if _, err := f.ReadAt(regions[:tableRegionSize], 0); err != nil {
+		return nil, err
+	}
+	if _, err := f.ReadAt(regions[tableRegionSize:], size-tableRegionSize); err != nil {
+		return nil, err
+	}
+
+	return regions, nil
+}
+
+// writeTableRegions writes regions as read by readTableRegions back.
+func writeTableRegions(device string, regions []byte) error {
+	if len(regions) != 2*tableRegionSize {
+		return errors.New("invalid partition table backup")
+	}
+
+	f, err := os.OpenFile(device, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = f.WriteAt(regions[:tableRegionSize], 0)
+	}
+	if err == nil {
+		_, err = f.WriteAt(regions[tableRegionSize:], size-tableRegionSize)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func fingerprint(regions []byte) string {
+	sum := sha256.Sum256(regions)
+	return hex.EncodeToString(sum[:])
+}
+
+// backupPartitionTable saves the partition table regions of device before it
+// gets repartitioned.
+func backupPartitionTable(device string, backupPath string) error {
+	regions, err := readTableRegions(device)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(backupPath), 0o700); err != nil {
+		return err
+	}
+	return atomic.WriteFile(backupPath, bytes.NewReader(regions))
+}
+
+// restorePartitionTable writes the backup back to device, provided its
+// partition table regions still match the fingerprint taken after it was
+// partitioned, i.e. nothing else touched the disk since.
+func restorePartitionTable(device string, backupPath string, expected string) error {
+	current, err := readTableRegions(device)
+	if err != nil {
+		return err
+	}
+	if fingerprint(current) != expected {
+		return fmt.Errorf("partition table of %s was modified since it was prepared, not restoring", device)
+	}
+
+	backup, err := os.ReadFile(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to read partition table backup: %w", err)
+	}
+
+	return writeTableRegions(device, backup)
+}
+
+// checkRestore checks whether the partition changes of a pending move can be
+// undone when cancelling it. The partition table of the boot disk is never
+// restored from the backup, it is in use.
+func checkRestore(state moveState, hasState bool, bootDevice string) error {
+	switch {
+	case !hasState:
+		return errors.New("no data move state available")
+	case state.Internal && state.PartitionUUID == "":
+		return errors.New("partition prepared on the boot disk is unknown")
+	case state.Internal:
+		return nil
+	case state.Target == bootDevice:
+		return fmt.Errorf("not restoring the partition table of the boot disk %s", bootDevice)
+	case state.Fingerprint == "":
+		return errors.New("no partition table backup of the target available")
+	}
+	return nil
+}
+
+// preparedPartition returns the partition prepared on the target of a move,
+// provided it is unchanged and unused since.
+func preparedPartition(state moveState, partitions []udisks2.PartitionInfo) (udisks2.PartitionInfo, error) {
+	for _, partition := range partitions {
+		if state.PartitionUUID == "" || !strings.EqualFold(partition.UUID, state.PartitionUUID) {
+			continue
+		}
+		if partition.Name != externalPartitionName {
+			return partition, fmt.Errorf("partition %s was renamed to %q since it was prepared", partition.Device, partition.Name)
+		}
+		if len(partition.MountPoints) > 0 {
+			return partition, fmt.Errorf("partition %s is mounted", partition.Device)
+		}
+		return partition, nil
+	}
+
+	return udisks2.PartitionInfo{}, fmt.Errorf("partition prepared on %s not found", state.Target)
+}
+
+// moveOutcome determines how a move which was attempted on boot, i.e. its
+// marker is gone, ended, based on the partition UUID of the data partition.
+// An empty dataPartitionUUID means the data partition could not be resolved.
+func moveOutcome(state moveState, dataPartitionUUID string) string {
+	if state.PartitionUUID == "" || dataPartitionUUID == "" {
+		return moveUnknown
+	}
+	if strings.EqualFold(dataPartitionUUID, state.PartitionUUID) {
+		return moveSucceeded
+	}
+	return moveFailed
+}
+
+// finishMove records the result of a move and drops its pending state.
+func finishMove(state moveState, outcome string) (moveResult, error) {
+	result := moveResult{moveState: state, Outcome: outcome}
+	if err := writeJSON(resultPath(), result); err != nil {
+		return result, err
+	}
+
+	for _, path := range []string{statePath(), tableBackupPath()} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func newMoveState(source string, target string) moveState {
+	return moveState{Source: source, Target: target, Time: time.Now().Unix()}
+}
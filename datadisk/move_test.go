@@ -0,0 +1,208 @@
+package datadisk
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/home-assistant/os-agent/udisks2"
+)
+
+func createDisk(t *testing.T, fill byte) string {
+	t.Helper()
+
+	device := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(device, bytes.Repeat([]byte{fill}, 4*tableRegionSize), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return device
+}
+
+func writeAt(t *testing.T, device string, offset int64, data []byte) {
+	t.Helper()
+
+	f, err := os.OpenFile(device, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(data, offset); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestorePartitionTable(t *testing.T) {
+	device := createDisk(t, 0xaa)
+	backup := filepath.Join(t.TempDir(), "table.bin")
+	original, err := os.ReadFile(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backupPartitionTable(device, backup); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate partitioning, touching both table regions
+	writeAt(t, device, 0, []byte("new primary table"))
+	writeAt(t, device, 4*tableRegionSize-512, []byte("new backup table"))
+	regions, err := readTableRegions(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restorePartitionTable(device, backup, fingerprint(regions)); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := os.ReadFile(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, original) {
+		t.Error("partition table was not restored")
+	}
+}
+
+func TestRestorePartitionTableModified(t *testing.T) {
+	device := createDisk(t, 0)
+	backup := filepath.Join(t.TempDir(), "table.bin")
+
+	if err := backupPartitionTable(device, backup); err != nil {
+		t.Fatal(err)
+	}
+	regions, err := readTableRegions(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fingerprint(regions)
+
+	writeAt(t, device, 512, []byte("repartitioned elsewhere"))
+
+	if err := restorePartitionTable(device, backup, expected); err == nil {
+		t.Error("expected restore to be refused after modification")
+	}
+}
+
+func TestReadTableRegionsTooSmall(t *testing.T) {
+	device := filepath.Join(t.TempDir(), "small.img")
+	if err := os.WriteFile(device, make([]byte, tableRegionSize), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readTableRegions(device); err == nil {
+		t.Error("expected error for device smaller than the table regions")
+	}
+}
+
+func TestMoveOutcome(t *testing.T) {
+	state := moveState{Source: "/dev/mmcblk0", Target: "/dev/sda", PartitionUUID: "6f1b2c3d-0a4e-4b5f-9c8d-7e6f5a4b3c2d"}
+
+	tests := []struct {
+		state    moveState
+		dataUUID string
+		outcome  string
+	}{
+		{state: state, dataUUID: "6F1B2C3D-0A4E-4B5F-9C8D-7E6F5A4B3C2D", outcome: moveSucceeded},
+		{state: state, dataUUID: "a0b1c2d3-e4f5-4a6b-8c7d-9e0f1a2b3c4d", outcome: moveFailed},
+		{state: state, dataUUID: "", outcome: moveUnknown},
+		{state: moveState{Source: "/dev/mmcblk0", Target: "/dev/sda"}, dataUUID: "a0b1c2d3-e4f5-4a6b-8c7d-9e0f1a2b3c4d", outcome: moveUnknown},
+	}
+
+	for _, tt := range tests {
+		if outcome := moveOutcome(tt.state, tt.dataUUID); outcome != tt.outcome {
+			t.Errorf("%+v with data partition %q: expected %s, got %s", tt.state, tt.dataUUID, tt.outcome, outcome)
+		}
+	}
+}
+
+func TestCheckRestore(t *testing.T) {
+	external := moveState{Source: "/dev/mmcblk0", Target: "/dev/sda", Fingerprint: "abc"}
+	internal := moveState{Source: "/dev/sda", Target: "/dev/mmcblk0", PartitionUUID: "6f1b2c3d-0a4e-4b5f-9c8d-7e6f5a4b3c2d", Internal: true}
+
+	if err := checkRestore(external, true, "/dev/mmcblk0"); err != nil {
+		t.Errorf("expected restoring an external target to be allowed, got %s", err)
+	}
+	if err := checkRestore(internal, true, "/dev/mmcblk0"); err != nil {
+		t.Errorf("expected reverting the internal partition to be allowed, got %s", err)
+	}
+
+	refused := []moveState{
+		// The backup of the boot disk's table must never be written back
+		{Source: "/dev/sda", Target: "/dev/mmcblk0", Fingerprint: "abc"},
+		{Source: "/dev/mmcblk0", Target: "/dev/sda"},
+		{Source: "/dev/sda", Target: "/dev/mmcblk0", Internal: true},
+	}
+	for _, state := range refused {
+		if err := checkRestore(state, true, "/dev/mmcblk0"); err == nil {
+			t.Errorf("%+v: expected restore to be refused", state)
+		}
+	}
+	if err := checkRestore(moveState{}, false, "/dev/mmcblk0"); err == nil {
+		t.Error("expected restore without state to be refused")
+	}
+}
+
+func TestPreparedPartition(t *testing.T) {
+	state := moveState{Target: "/dev/mmcblk0", PartitionUUID: "6f1b2c3d-0a4e-4b5f-9c8d-7e6f5a4b3c2d", Internal: true}
+	boot := udisks2.PartitionInfo{Device: "/dev/mmcblk0p1", Name: labelBoot, UUID: "a0b1c2d3-e4f5-4a6b-8c7d-9e0f1a2b3c4d"}
+	prepared := udisks2.PartitionInfo{Device: "/dev/mmcblk0p9", Name: externalPartitionName, UUID: "6F1B2C3D-0A4E-4B5F-9C8D-7E6F5A4B3C2D"}
+
+	partition, err := preparedPartition(state, []udisks2.PartitionInfo{boot, prepared})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if partition.Device != "/dev/mmcblk0p9" {
+		t.Errorf("expected the prepared partition, got %+v", partition)
+	}
+
+	renamed, mounted := prepared, prepared
+	renamed.Name = labelData
+	mounted.MountPoints = []string{"/mnt/data"}
+	for _, partitions := range [][]udisks2.PartitionInfo{{boot}, {boot, renamed}, {boot, mounted}} {
+		if _, err := preparedPartition(state, partitions); err == nil {
+			t.Errorf("%+v: expected an error", partitions)
+		}
+	}
+}
+
+// useStateDir points the agent state to a temporary directory for the test.
+func useStateDir(t *testing.T) {
+	t.Helper()
+	previous := stateDir
+	stateDir = t.TempDir()
+	t.Cleanup(func() { stateDir = previous })
+}
+
+func TestFinishMove(t *testing.T) {
+	useStateDir(t)
+
+	state := newMoveState("/dev/mmcblk0", "/dev/sda")
+	state.Fingerprint = "abc"
+	if err := writeJSON(statePath(), state); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tableBackupPath(), []byte("table"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := finishMove(state, moveCancelled); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{statePath(), tableBackupPath()} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", path)
+		}
+	}
+
+	var result moveResult
+	found, err := readJSON(resultPath(), &result)
+	if err != nil || !found {
+		t.Fatalf("expected result to be recorded, found %t: %v", found, err)
+	}
+	if result.Outcome != moveCancelled || result.Target != "/dev/sda" || result.Time != state.Time {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
@@ -0,0 +1,193 @@
+package datadisk
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+
+	logging "github.com/home-assistant/os-agent/utils/log"
+)
+
+const (
+	usageRefreshInterval = time.Minute
+
+	defaultLowSpaceWarning  = 5 << 30
+	defaultLowSpaceCritical = 1 << 30
+)
+
+// Levels reported by the LowSpace signal.
+const (
+	spaceOK       = "ok"
+	spaceWarning  = "warning"
+	spaceCritical = "critical"
+)
+
+// diskUsage is the usage of the data file system. Free is the space
+// available to unprivileged users, which is what e.g. Docker gets to use.
+type diskUsage struct {
+	Total      uint64
+	Used       uint64
+	Free       uint64
+	InodesFree uint64
+}
+
+// lowSpaceThresholds are the free space limits in bytes below which the
+// LowSpace signal is emitted.
+type lowSpaceThresholds struct {
+	Warning  uint64 `json:"warning"`
+	Critical uint64 `json:"critical"`
+}
+
+var (
+	thresholds = lowSpaceThresholds{Warning: defaultLowSpaceWarning, Critical: defaultLowSpaceCritical}
+	// thresholdsMu guards thresholds, which are read by the property
+	// callbacks while the properties are locked.
+	thresholdsMu sync.Mutex
+)
+
+func thresholdsPath() string {
+	return filepath.Join(stateDir, "low-space.json")
+}
+
+func readDiskUsage(path string) (diskUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return diskUsage{}, err
+	}
+
+	bsize := uint64(stat.Bsize) //nolint:gosec
+	return diskUsage{
+		Total:      stat.Blocks * bsize,
+		Used:       (stat.Blocks - stat.Bfree) * bsize,
+		Free:       stat.Bavail * bsize,
+		InodesFree: stat.Ffree,
+	}, nil
+}
+
+// spaceLevel classifies the free space on the data disk.
+func spaceLevel(free uint64, limits lowSpaceThresholds) string {
+	switch {
+	case free < limits.Critical:
+		return spaceCritical
+	case free < limits.Warning:
+		return spaceWarning
+	default:
+		return spaceOK
+	}
+}
+
+func validateThresholds(limits lowSpaceThresholds) error {
+	if limits.Critical > limits.Warning {
+		return fmt.Errorf("critical low space threshold of %d bytes exceeds the warning threshold of %d bytes", limits.Critical, limits.Warning)
+	}
+	return nil
+}
+
+// validateLowSpace checks new thresholds against each other, using the new
+// value of the other threshold if it is changed as well.
+func validateLowSpace(changes map[string]any) error {
+	thresholdsMu.Lock()
+	limits := thresholds
+	thresholdsMu.Unlock()
+
+	if value, ok := changes["LowSpaceWarningBytes"].(uint64); ok {
+		limits.Warning = value
+	}
+	if value, ok := changes["LowSpaceCriticalBytes"].(uint64); ok {
+		limits.Critical = value
+	}
+
+	return validateThresholds(limits)
+}
+
+func loadThresholds() {
+	thresholdsMu.Lock()
+	defer thresholdsMu.Unlock()
+
+	limits := thresholds
+	if _, err := readJSON(thresholdsPath(), &limits); err != nil {
+		logging.Warning.Printf("Failed to read low space thresholds: %s", err)
+		return
+	}
+	if err := validateThresholds(limits); err != nil {
+		logging.Warning.Printf("Ignoring saved low space thresholds: %s", err)
+		return
+	}
+	thresholds = limits
+}
+
+func setThreshold(update func(limits *lowSpaceThresholds, value uint64)) func(c *prop.Change) *dbus.Error {
+	return func(c *prop.Change) *dbus.Error {
+		value, ok := c.Value.(uint64)
+		if !ok {
+			return dbus.MakeFailedError(fmt.Errorf("%s must be uint64, got %T", c.Name, c.Value))
+		}
+
+		thresholdsMu.Lock()
+		defer thresholdsMu.Unlock()
+
+		limits := thresholds
+		update(&limits, value)
+		if err := validateThresholds(limits); err != nil {
+			return dbus.MakeFailedError(err)
+		}
+		if err := writeJSON(thresholdsPath(), limits); err != nil {
+			return dbus.MakeFailedError(fmt.Errorf("failed to save low space thresholds: %w", err))
+		}
+		thresholds = limits
+
+		logging.Info.Printf("Set data disk %s to %d", c.Name, value)
+		return nil
+	}
+}
+
+var (
+	setLowSpaceWarning = setThreshold(func(limits *lowSpaceThresholds, value uint64) {
+		limits.Warning = value
+	})
+	setLowSpaceCritical = setThreshold(func(limits *lowSpaceThresholds, value uint64) {
+		limits.Critical = value
+	})
+)
+
+// updateUsage refreshes the usage properties and emits LowSpace when the free
+// space crosses one of the thresholds. Signals are only emitted for values
+// which actually changed.
+func (d datadisk) updateUsage() {
+	usage, err := readDiskUsage(dataMount)
+	if err != nil {
+		logging.Warning.Printf("Failed to read data disk usage: %s", err)
+		return
+	}
+
+	values := map[string]uint64{
+		"TotalBytes": usage.Total,
+		"UsedBytes":  usage.Used,
+		"FreeBytes":  usage.Free,
+		"InodesFree": usage.InodesFree,
+	}
+	for name, value := range values {
+		if d.props.GetMust(ifaceName, name).(uint64) != value {
+			d.props.SetMust(ifaceName, name, value)
+		}
+	}
+
+	thresholdsMu.Lock()
+	level := spaceLevel(usage.Free, thresholds)
+	thresholdsMu.Unlock()
+
+	if d.props.GetMust(ifaceName, "LowSpaceLevel").(string) == level {
+		return
+	}
+	d.props.SetMust(ifaceName, "LowSpaceLevel", level)
+
+	logging.Info.Printf("Data disk space level changed to %s, %d bytes free.", level, usage.Free)
+	if err := d.conn.Emit(objectPath, ifaceName+".LowSpace", level); err != nil {
+		logging.Warning.Printf("Failed to emit LowSpace signal: %s", err)
+	}
+}
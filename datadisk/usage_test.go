@@ -0,0 +1,106 @@
+package datadisk
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/home-assistant/os-agent/utils/settings"
+)
+
+func TestSpaceLevel(t *testing.T) {
+	limits := lowSpaceThresholds{Warning: 5 << 30, Critical: 1 << 30}
+
+	tests := []struct {
+		free  uint64
+		level string
+	}{
+		{free: 10 << 30, level: spaceOK},
+		{free: 5 << 30, level: spaceOK},
+		{free: 5<<30 - 1, level: spaceWarning},
+		{free: 1 << 30, level: spaceWarning},
+		{free: 1<<30 - 1, level: spaceCritical},
+		{free: 0, level: spaceCritical},
+	}
+
+	for _, tt := range tests {
+		if level := spaceLevel(tt.free, limits); level != tt.level {
+			t.Errorf("free %d: expected %s, got %s", tt.free, tt.level, level)
+		}
+	}
+}
+
+// useThresholds sets the low space thresholds for the test.
+func useThresholds(t *testing.T, limits lowSpaceThresholds) {
+	t.Helper()
+	thresholdsMu.Lock()
+	previous := thresholds
+	thresholds = limits
+	thresholdsMu.Unlock()
+	t.Cleanup(func() {
+		thresholdsMu.Lock()
+		thresholds = previous
+		thresholdsMu.Unlock()
+	})
+}
+
+func TestValidateLowSpace(t *testing.T) {
+	useThresholds(t, lowSpaceThresholds{Warning: defaultLowSpaceWarning, Critical: defaultLowSpaceCritical})
+
+	if err := validateLowSpace(map[string]any{"LowSpaceCriticalBytes": uint64(2 << 30)}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := validateLowSpace(map[string]any{"LowSpaceCriticalBytes": uint64(10 << 30)}); err == nil {
+		t.Error("expected error for critical threshold above warning threshold")
+	}
+	changes := map[string]any{"LowSpaceWarningBytes": uint64(20 << 30), "LowSpaceCriticalBytes": uint64(10 << 30)}
+	if err := validateLowSpace(changes); err != nil {
+		t.Errorf("unexpected error when raising both thresholds: %s", err)
+	}
+}
+
+func TestSetThreshold(t *testing.T) {
+	useStateDir(t)
+	useThresholds(t, lowSpaceThresholds{Warning: defaultLowSpaceWarning, Critical: defaultLowSpaceCritical})
+
+	if err := setLowSpaceWarning(&prop.Change{Name: "LowSpaceWarningBytes", Value: uint64(512 << 20)}); err == nil {
+		t.Error("expected error for warning threshold below critical threshold")
+	}
+	if err := setLowSpaceCritical(&prop.Change{Name: "LowSpaceCriticalBytes", Value: uint64(2 << 30)}); err != nil {
+		t.Fatal(err)
+	}
+
+	thresholds = lowSpaceThresholds{}
+	loadThresholds()
+	if thresholds.Warning != defaultLowSpaceWarning || thresholds.Critical != 2<<30 {
+		t.Errorf("unexpected thresholds after reload %+v", thresholds)
+	}
+}
+
+func TestApplyLowSpaceThresholds(t *testing.T) {
+	useStateDir(t)
+	useThresholds(t, lowSpaceThresholds{Warning: 5 << 30, Critical: 1 << 30})
+	props := callbackProperties{
+		values: map[string]any{"LowSpaceWarningBytes": uint64(5 << 30), "LowSpaceCriticalBytes": uint64(1 << 30)},
+		callbacks: map[string]func(c *prop.Change) *dbus.Error{
+			"LowSpaceWarningBytes":  setLowSpaceWarning,
+			"LowSpaceCriticalBytes": setLowSpaceCritical,
+		},
+	}
+	settings.Register(ifaceName, props, []string{"LowSpaceWarningBytes", "LowSpaceCriticalBytes"}, []string{thresholdsPath()}, validateLowSpace)
+
+	// Raising and lowering both thresholds past the current other one
+	for _, limits := range []lowSpaceThresholds{{Warning: 20 << 30, Critical: 10 << 30}, {Warning: 512 << 20, Critical: 256 << 20}} {
+		err := settings.Apply([]settings.Change{
+			{Interface: ifaceName, Property: "LowSpaceWarningBytes", Value: dbus.MakeVariant(limits.Warning)},
+			{Interface: ifaceName, Property: "LowSpaceCriticalBytes", Value: dbus.MakeVariant(limits.Critical)},
+		})
+		if err != nil {
+			t.Fatalf("failed to apply %+v: %s", limits, err)
+		}
+		if thresholds != limits {
+			t.Errorf("expected thresholds %+v, got %+v", limits, thresholds)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package datadisk
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/home-assistant/os-agent/utils/filehistory"
+	logging "github.com/home-assistant/os-agent/utils/log"
+	"github.com/home-assistant/os-agent/utils/settings"
+)
+
+const (
+	wearObjectPath = "/io/hass/os/DataDisk/Wear"
+	wearIfaceName  = "io.hass.os.DataDisk.Wear"
+
+	wearRefreshInterval = 10 * time.Minute
+
+	defaultWearWarning  = 80
+	defaultWearCritical = 90
+)
+
+// Wear levels of a device.
+const (
+	wearOK       = "ok"
+	wearWarning  = "warning"
+	wearCritical = "critical"
+)
+
+var (
+	sysBlockPath = "/sys/block"
+	bootIDPath   = "/proc/sys/kernel/random/boot_id"
+	// deviceIDAttributes are the sysfs attributes of a disk which identify
+	// it, in order of preference: the WWID of NVMe and SCSI disks and the
+	// serial number or CID of eMMC devices.
+	deviceIDAttributes = []string{"wwid", "device/wwid", "device/serial", "device/cid"}
+	// partitionsRegexp matches the hardware partitions of eMMC devices, which
+	// share the wear information of their device
+	partitionsRegexp = regexp.MustCompile(`^mmcblk\d+(boot\d+|rpmb)$`)
+	preEOLInfo       = map[uint64]string{1: "normal", 2: "warning", 3: "urgent"}
+
+	wearThresholds = wearLimits{Warning: defaultWearWarning, Critical: defaultWearCritical}
+	// writtenCounters are the bytes written counters by device ID, loaded
+	// from disk on the first read.
+	writtenCounters map[string]writtenCounter
+	// wearMu guards wearThresholds and writtenCounters.
+	wearMu sync.Mutex
+)
+
+// wearLimits are the estimated percentages of life time used from which on
+// a device is reported as worn.
+type wearLimits struct {
+	Warning  uint32 `json:"warning"`
+	Critical uint32 `json:"critical"`
+}
+
+// writtenCounter accumulates the bytes written to a device across boots, the
+// kernel statistics start at zero on every boot.
+type writtenCounter struct {
+	BootID string `json:"boot_id"`
+	// Base is the amount written during previous boots
+	Base uint64 `json:"base"`
+	// Last is the amount written during the current boot when last read
+	Last uint64 `json:"last"`
+}
+
+// wearDevice is the (siisst) wear description of a device. LifeTimeA and
+// LifeTimeB are the estimated percentages of life time used of the two
+// memory types of eMMC devices, -1 if not reported.
+type wearDevice struct {
+	Device       string
+	LifeTimeA    int32
+	LifeTimeB    int32
+	PreEOL       string
+	Level        string
+	BytesWritten uint64
+}
+
+type wear struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+}
+
+func wearThresholdsPath() string {
+	return filepath.Join(stateDir, "wear-thresholds.json")
+}
+
+func bytesWrittenPath() string {
+	return filepath.Join(stateDir, "bytes-written.json")
+}
+
+// parseLifeTime parses the two estimates of life_time, e.g. "0x01 0x02", into
+// the upper bound of the percentages of life time used. 0x0b means the
+// estimated life time was exceeded.
+func parseLifeTime(content string) (int32, int32) {
+	estimates := []int32{-1, -1}
+	for idx, field := range strings.Fields(content) {
+		if idx >= len(estimates) {
+			break
+		}
+		value, err := strconv.ParseUint(field, 0, 8)
+		if err != nil || value == 0 || value > 0x0b {
+			continue
+		}
+		estimates[idx] = int32(min(value*10, 100)) //nolint:gosec
+	}
+
+	return estimates[0], estimates[1]
+}
+
+func parsePreEOL(content string) string {
+	value, err := strconv.ParseUint(strings.TrimSpace(content), 0, 8)
+	if err != nil {
+		return "unknown"
+	}
+	if info, ok := preEOLInfo[value]; ok {
+		return info
+	}
+	return "unknown"
+}
+
+// parseSectorsWritten returns the bytes written according to a block device
+// stat file, the seventh field counts 512 byte sectors.
+func parseSectorsWritten(content string) (uint64, error) {
+	fields := strings.Fields(content)
+	if len(fields) < 7 {
+		return 0, fmt.Errorf("unexpected block device statistics %q", content)
+	}
+
+	sectors, err := strconv.ParseUint(fields[6], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return sectors * 512, nil
+}
+
+// accumulate adds the current reading of a boot to the counter. A reading
+// below the last one within the same boot means the device was re-added.
+func (c writtenCounter) accumulate(bootID string, current uint64) writtenCounter {
+	if c.BootID != bootID || current < c.Last {
+		c.Base += c.Last
+		c.BootID = bootID
+	}
+	c.Last = current
+	return c
+}
+
+func (c writtenCounter) total() uint64 {
+	return c.Base + c.Last
+}
+
+// wearLevel classifies a device by its worst life time estimate and its
+// pre-EOL information.
+func wearLevel(device wearDevice, limits wearLimits) string {
+	used := max(device.LifeTimeA, device.LifeTimeB)
+	known := used >= 0
+	percent := uint32(used) //nolint:gosec
+	switch {
+	case device.PreEOL == "urgent" || known && percent >= limits.Critical:
+		return wearCritical
+	case device.PreEOL == "warning" || known && percent >= limits.Warning:
+		return wearWarning
+	default:
+		return wearOK
+	}
+}
+
+func readSysfs(path string) (string, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	return string(content), true
+}
+
+// deviceID returns a stable identifier of a disk, its kernel name depends on
+// the order the disks were detected in. Disks without any identifying
+// attribute fall back to their kernel name.
+func deviceID(name string) string {
+	for _, attribute := range deviceIDAttributes {
+		if content, ok := readSysfs(filepath.Join(sysBlockPath, name, attribute)); ok {
+			if id := strings.TrimSpace(content); id != "" {
+				return id
+			}
+		}
+	}
+	return name
+}
+
+// readWearDevices reads the wear information of all disks, updating the
+// bytes written counters.
+func readWearDevices(bootID string, counters map[string]writtenCounter, limits wearLimits) []wearDevice {
+	entries, err := os.ReadDir(sysBlockPath)
+	if err != nil {
+		logging.Warning.Printf("Failed to read %s: %s", sysBlockPath, err)
+		return []wearDevice{}
+	}
+
+	devices := []wearDevice{}
+	for _, entry := range entries {
+		name := entry.Name()
+		// Only disks backed by hardware, e.g. no loop, zram or dm devices
+		if _, err := os.Stat(filepath.Join(sysBlockPath, name, "device")); err != nil || partitionsRegexp.MatchString(name) {
+			continue
+		}
+
+		device := wearDevice{Device: "/dev/" + name, LifeTimeA: -1, LifeTimeB: -1, PreEOL: "unknown"}
+		if content, ok := readSysfs(filepath.Join(sysBlockPath, name, "device", "life_time")); ok {
+			device.LifeTimeA, device.LifeTimeB = parseLifeTime(content)
+		}
+		if content, ok := readSysfs(filepath.Join(sysBlockPath, name, "device", "pre_eol_info")); ok {
+			device.PreEOL = parsePreEOL(content)
+		}
+		id := deviceID(name)
+		if content, ok := readSysfs(filepath.Join(sysBlockPath, name, "stat")); ok {
+			if written, err := parseSectorsWritten(content); err == nil {
+				counters[id] = counters[id].accumulate(bootID, written)
+			}
+		}
+		device.BytesWritten = counters[id].total()
+		device.Level = wearLevel(device, limits)
+
+		devices = append(devices, device)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Device < devices[j].Device
+	})
+	return devices
+}
+
+func validateWearLimits(limits wearLimits) error {
+	if limits.Warning > 100 || limits.Critical > 100 {
+		return fmt.Errorf("wear thresholds must be percentages between 0 and 100")
+	}
+	if limits.Warning > limits.Critical {
+		return fmt.Errorf("wear warning threshold of %d%% exceeds the critical threshold of %d%%", limits.Warning, limits.Critical)
+	}
+	return nil
+}
+
+// validateWear checks new thresholds against each other, using the new
+// value of the other threshold if it is changed as well.
+func validateWear(changes map[string]any) error {
+	wearMu.Lock()
+	limits := wearThresholds
+	wearMu.Unlock()
+
+	if value, ok := changes["WearWarningPercent"].(uint32); ok {
+		limits.Warning = value
+	}
+	if value, ok := changes["WearCriticalPercent"].(uint32); ok {
+		limits.Critical = value
+	}
+
+	return validateWearLimits(limits)
+}
+
+func setWearThreshold(update func(limits *wearLimits, value uint32)) func(c *prop.Change) *dbus.Error {
+	return func(c *prop.Change) *dbus.Error {
+		value, ok := c.Value.(uint32)
+		if !ok {
+			return dbus.MakeFailedError(fmt.Errorf("%s must be uint32, got %T", c.Name, c.Value))
+		}
+
+		wearMu.Lock()
+		defer wearMu.Unlock()
+
+		limits := wearThresholds
+		update(&limits, value)
+		if err := validateWearLimits(limits); err != nil {
+			return dbus.MakeFailedError(err)
+		}
+		if err := writeJSON(wearThresholdsPath(), limits); err != nil {
+			return dbus.MakeFailedError(fmt.Errorf("failed to save wear thresholds: %w", err))
+		}
+		wearThresholds = limits
+
+		logging.Info.Printf("Set data disk %s to %d", c.Name, value)
+		return nil
+	}
+}
+
+var (
+	setWearWarning = setWearThreshold(func(limits *wearLimits, value uint32) {
+		limits.Warning = value
+	})
+	setWearCritical = setWearThreshold(func(limits *wearLimits, value uint32) {
+		limits.Critical = value
+	})
+)
+
+// readWear reads the wear information of all disks. The bytes written
+// counters are saved whenever they changed, which happens at most once per
+// refresh, so only the writes since the last refresh of a boot are lost.
+func readWear() []wearDevice {
+	wearMu.Lock()
+	defer wearMu.Unlock()
+
+	if writtenCounters == nil {
+		writtenCounters = map[string]writtenCounter{}
+		if _, err := readJSON(bytesWrittenPath(), &writtenCounters); err != nil {
+			logging.Warning.Printf("Failed to read bytes written counters: %s", err)
+		}
+	}
+
+	bootID, _ := readSysfs(bootIDPath)
+	previous := maps.Clone(writtenCounters)
+	devices := readWearDevices(strings.TrimSpace(bootID), writtenCounters, wearThresholds)
+
+	if !maps.Equal(previous, writtenCounters) {
+		if err := writeJSON(bytesWrittenPath(), writtenCounters); err != nil {
+			logging.Warning.Printf("Failed to save bytes written counters: %s", err)
+		}
+	}
+	return devices
+}
+
+// refresh re-reads the wear information, signals are only emitted if it
+// changed.
+func (w wear) refresh() {
+	previous := map[string]string{}
+	for _, device := range w.props.GetMust(wearIfaceName, "Devices").([]wearDevice) {
+		previous[device.Device] = device.Level
+	}
+
+	devices := readWear()
+	settings.Refresh(w.props, wearIfaceName, map[string]any{"Devices": devices})
+
+	for _, device := range devices {
+		if level, ok := previous[device.Device]; device.Level != wearOK && (!ok || level != device.Level) {
+			logging.Warning.Printf("Device %s is worn, level %s (life time used %d%%/%d%%, pre-EOL %s).",
+				device.Device, device.Level, device.LifeTimeA, device.LifeTimeB, device.PreEOL)
+		}
+	}
+}
+
+func initializeWear(conn *dbus.Conn) {
+	w := wear{
+		conn: conn,
+	}
+
+	wearMu.Lock()
+	limits := wearThresholds
+	if _, err := readJSON(wearThresholdsPath(), &limits); err != nil {
+		logging.Warning.Printf("Failed to read wear thresholds: %s", err)
+	} else if err := validateWearLimits(limits); err != nil {
+		logging.Warning.Printf("Ignoring saved wear thresholds: %s", err)
+	} else {
+		wearThresholds = limits
+	}
+	wearMu.Unlock()
+
+	propsSpec := map[string]map[string]*prop.Prop{
+		wearIfaceName: {
+			"Devices": {
+				Value:    readWear(),
+				Writable: false,
+				Emit:     prop.EmitTrue,
+				Callback: nil,
+			},
+			"WearWarningPercent": {
+				Value:    wearThresholds.Warning,
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: setWearWarning,
+			},
+			"WearCriticalPercent": {
+				Value:    wearThresholds.Critical,
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: setWearCritical,
+			},
+		},
+	}
+
+	props, err := prop.Export(conn, wearObjectPath, propsSpec)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+	w.props = props
+	files := []string{wearThresholdsPath()}
+	settings.Register(wearIfaceName, props, []string{"WearWarningPercent", "WearCriticalPercent"}, files, validateWear)
+
+	err = filehistory.ExportProperties(conn, wearObjectPath, props, files)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	err = conn.Export(w, wearObjectPath, wearIfaceName)
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	node := &introspect.Node{
+		Name: wearObjectPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       wearIfaceName,
+				Methods:    introspect.Methods(w),
+				Properties: props.Introspection(wearIfaceName),
+			},
+		},
+	}
+
+	err = conn.Export(introspect.NewIntrospectable(node), wearObjectPath, "org.freedesktop.DBus.Introspectable")
+	if err != nil {
+		logging.Critical.Panic(err)
+	}
+
+	logging.Info.Printf("Exposing object %s with interface %s ...", wearObjectPath, wearIfaceName)
+
+	go func() {
+		for range time.Tick(wearRefreshInterval) {
+			w.refresh()
+		}
+	}()
+}
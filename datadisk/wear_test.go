@@ -0,0 +1,272 @@
+package datadisk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/home-assistant/os-agent/utils/settings"
+)
+
+// callbackProperties runs the property callbacks like prop.Properties does,
+// without exporting the properties on a bus.
+type callbackProperties struct {
+	values    map[string]any
+	callbacks map[string]func(c *prop.Change) *dbus.Error
+}
+
+func (p callbackProperties) Get(iface string, property string) (dbus.Variant, *dbus.Error) {
+	return dbus.MakeVariant(p.values[property]), nil
+}
+
+func (p callbackProperties) Set(iface string, property string, value dbus.Variant) *dbus.Error {
+	if err := p.callbacks[property](&prop.Change{Iface: iface, Name: property, Value: value.Value()}); err != nil {
+		return err
+	}
+	p.values[property] = value.Value()
+	return nil
+}
+
+// useWearThresholds sets the wear thresholds for the test.
+func useWearThresholds(t *testing.T, limits wearLimits) {
+	t.Helper()
+	wearMu.Lock()
+	previous := wearThresholds
+	wearThresholds = limits
+	wearMu.Unlock()
+	t.Cleanup(func() {
+		wearMu.Lock()
+		wearThresholds = previous
+		wearMu.Unlock()
+	})
+}
+
+func TestParseLifeTime(t *testing.T) {
+	tests := []struct {
+		content string
+		a       int32
+		b       int32
+	}{
+		{content: "0x01 0x02\n", a: 10, b: 20},
+		{content: "0x0a 0x0b\n", a: 100, b: 100},
+		{content: "0x00 0x03\n", a: -1, b: 30},
+		{content: "garbage", a: -1, b: -1},
+		{content: "", a: -1, b: -1},
+	}
+
+	for _, tt := range tests {
+		a, b := parseLifeTime(tt.content)
+		if a != tt.a || b != tt.b {
+			t.Errorf("%q: expected %d/%d, got %d/%d", tt.content, tt.a, tt.b, a, b)
+		}
+	}
+}
+
+func TestParsePreEOL(t *testing.T) {
+	for content, expected := range map[string]string{"0x01\n": "normal", "0x02": "warning", "0x03": "urgent", "0x00": "unknown", "": "unknown"} {
+		if info := parsePreEOL(content); info != expected {
+			t.Errorf("%q: expected %s, got %s", content, expected, info)
+		}
+	}
+}
+
+func TestParseSectorsWritten(t *testing.T) {
+	written, err := parseSectorsWritten("    4182     1057   358234     2305    10502    11480   892016    98020        0    41028   100325")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 892016*512 {
+		t.Errorf("expected %d bytes, got %d", 892016*512, written)
+	}
+
+	if _, err := parseSectorsWritten("1 2 3"); err == nil {
+		t.Error("expected error for truncated statistics")
+	}
+}
+
+func TestWrittenCounter(t *testing.T) {
+	var counter writtenCounter
+
+	counter = counter.accumulate("boot-1", 100)
+	counter = counter.accumulate("boot-1", 250)
+	if counter.total() != 250 {
+		t.Errorf("expected 250, got %d", counter.total())
+	}
+
+	// New boot, the kernel statistics start over
+	counter = counter.accumulate("boot-2", 50)
+	if counter.total() != 300 {
+		t.Errorf("expected 300, got %d", counter.total())
+	}
+
+	// Device re-added within the same boot
+	counter = counter.accumulate("boot-2", 10)
+	if counter.total() != 310 {
+		t.Errorf("expected 310, got %d", counter.total())
+	}
+}
+
+func TestWearLevel(t *testing.T) {
+	limits := wearLimits{Warning: 80, Critical: 90}
+
+	tests := []struct {
+		device wearDevice
+		level  string
+	}{
+		{device: wearDevice{LifeTimeA: -1, LifeTimeB: -1, PreEOL: "unknown"}, level: wearOK},
+		{device: wearDevice{LifeTimeA: 10, LifeTimeB: 70, PreEOL: "normal"}, level: wearOK},
+		{device: wearDevice{LifeTimeA: 80, LifeTimeB: 20, PreEOL: "normal"}, level: wearWarning},
+		{device: wearDevice{LifeTimeA: 10, LifeTimeB: 10, PreEOL: "warning"}, level: wearWarning},
+		{device: wearDevice{LifeTimeA: 100, LifeTimeB: -1, PreEOL: "normal"}, level: wearCritical},
+		{device: wearDevice{LifeTimeA: 10, LifeTimeB: 10, PreEOL: "urgent"}, level: wearCritical},
+	}
+
+	for _, tt := range tests {
+		if level := wearLevel(tt.device, limits); level != tt.level {
+			t.Errorf("%+v: expected %s, got %s", tt.device, tt.level, level)
+		}
+	}
+}
+
+func writeSysfs(t *testing.T, path string, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useSysBlock points the block device statistics to a temporary directory
+// and boot ID file for the test.
+func useSysBlock(t *testing.T, bootID string) {
+	t.Helper()
+	previousBlock, previousBootID := sysBlockPath, bootIDPath
+	sysBlockPath = t.TempDir()
+	bootIDPath = filepath.Join(t.TempDir(), "boot_id")
+	writeSysfs(t, bootIDPath, bootID+"\n")
+	t.Cleanup(func() { sysBlockPath, bootIDPath = previousBlock, previousBootID })
+}
+
+func TestReadWearDevices(t *testing.T) {
+	useSysBlock(t, "boot")
+	stat := "0 0 0 0 0 0 2048 0 0 0 0\n"
+
+	writeSysfs(t, filepath.Join(sysBlockPath, "mmcblk0", "device", "life_time"), "0x02 0x09\n")
+	writeSysfs(t, filepath.Join(sysBlockPath, "mmcblk0", "device", "pre_eol_info"), "0x01\n")
+	writeSysfs(t, filepath.Join(sysBlockPath, "mmcblk0", "stat"), stat)
+	writeSysfs(t, filepath.Join(sysBlockPath, "mmcblk0boot0", "device", "life_time"), "0x02 0x09\n")
+	writeSysfs(t, filepath.Join(sysBlockPath, "sda", "device", "model"), "Disk\n")
+	writeSysfs(t, filepath.Join(sysBlockPath, "sda", "stat"), stat)
+	writeSysfs(t, filepath.Join(sysBlockPath, "zram0", "stat"), stat)
+
+	counters := map[string]writtenCounter{"sda": {BootID: "old", Base: 0, Last: 1 << 20}}
+	devices := readWearDevices("boot", counters, wearLimits{Warning: 80, Critical: 90})
+
+	if len(devices) != 2 {
+		t.Fatalf("expected mmcblk0 and sda, got %+v", devices)
+	}
+	mmc, sda := devices[0], devices[1]
+	if mmc.Device != "/dev/mmcblk0" || mmc.LifeTimeA != 20 || mmc.LifeTimeB != 90 || mmc.PreEOL != "normal" || mmc.Level != wearCritical || mmc.BytesWritten != 2048*512 {
+		t.Errorf("unexpected mmcblk0 %+v", mmc)
+	}
+	if sda.Device != "/dev/sda" || sda.LifeTimeA != -1 || sda.PreEOL != "unknown" || sda.Level != wearOK || sda.BytesWritten != 1<<20+2048*512 {
+		t.Errorf("unexpected sda %+v", sda)
+	}
+}
+
+func TestDeviceID(t *testing.T) {
+	useSysBlock(t, "boot")
+	writeSysfs(t, filepath.Join(sysBlockPath, "nvme0n1", "wwid"), "eui.0025385b71b0a3f1\n")
+	writeSysfs(t, filepath.Join(sysBlockPath, "sda", "device", "wwid"), "t10.ATA     Disk 1234\n")
+	writeSysfs(t, filepath.Join(sysBlockPath, "mmcblk0", "device", "serial"), "0x1234abcd\n")
+	writeSysfs(t, filepath.Join(sysBlockPath, "mmcblk0", "device", "cid"), "150100424a54443452\n")
+	writeSysfs(t, filepath.Join(sysBlockPath, "sdb", "device", "model"), "Stick\n")
+
+	for name, id := range map[string]string{
+		"nvme0n1": "eui.0025385b71b0a3f1",
+		"sda":     "t10.ATA     Disk 1234",
+		"mmcblk0": "0x1234abcd",
+		"sdb":     "sdb",
+	} {
+		if got := deviceID(name); got != id {
+			t.Errorf("deviceID(%q) = %q, want %q", name, got, id)
+		}
+	}
+}
+
+func TestBytesWrittenAcrossBoots(t *testing.T) {
+	useStateDir(t)
+	useSysBlock(t, "boot-1")
+	wearMu.Lock()
+	previous := writtenCounters
+	writtenCounters = nil
+	wearMu.Unlock()
+	t.Cleanup(func() {
+		wearMu.Lock()
+		writtenCounters = previous
+		wearMu.Unlock()
+	})
+
+	writeDisk := func(name string, sectors string) {
+		writeSysfs(t, filepath.Join(sysBlockPath, name, "device", "wwid"), "naa.5000c500a1b2c3d4\n")
+		writeSysfs(t, filepath.Join(sysBlockPath, name, "stat"), "0 0 0 0 0 0 "+sectors+" 0 0 0 0\n")
+	}
+	reboot := func(bootID string) {
+		// The agent starts over, all it has are the saved counters
+		wearMu.Lock()
+		writtenCounters = nil
+		wearMu.Unlock()
+		writeSysfs(t, bootIDPath, bootID+"\n")
+		if err := os.RemoveAll(sysBlockPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// First boot, writes keep coming in between the refreshes
+	writeDisk("sda", "2048")
+	readWear()
+	writeDisk("sda", "4096")
+	readWear()
+
+	// The disk is detected as sdb on the second boot
+	reboot("boot-2")
+	writeDisk("sdb", "100")
+	devices := readWear()
+
+	if len(devices) != 1 || devices[0].Device != "/dev/sdb" || devices[0].BytesWritten != (4096+100)*512 {
+		t.Errorf("expected the writes of both boots, got %+v", devices)
+	}
+}
+
+func TestApplyWearThresholds(t *testing.T) {
+	useStateDir(t)
+	useWearThresholds(t, wearLimits{Warning: 70, Critical: 80})
+	props := callbackProperties{
+		values: map[string]any{"WearWarningPercent": uint32(70), "WearCriticalPercent": uint32(80)},
+		callbacks: map[string]func(c *prop.Change) *dbus.Error{
+			"WearWarningPercent":  setWearWarning,
+			"WearCriticalPercent": setWearCritical,
+		},
+	}
+	settings.Register(wearIfaceName, props, []string{"WearWarningPercent", "WearCriticalPercent"}, []string{wearThresholdsPath()}, validateWear)
+
+	// Raising and lowering both thresholds past the current other one
+	for _, limits := range []wearLimits{{Warning: 85, Critical: 95}, {Warning: 40, Critical: 60}} {
+		err := settings.Apply([]settings.Change{
+			{Interface: wearIfaceName, Property: "WearWarningPercent", Value: dbus.MakeVariant(limits.Warning)},
+			{Interface: wearIfaceName, Property: "WearCriticalPercent", Value: dbus.MakeVariant(limits.Critical)},
+		})
+		if err != nil {
+			t.Fatalf("failed to apply %+v: %s", limits, err)
+		}
+		if wearThresholds != limits {
+			t.Errorf("expected thresholds %+v, got %+v", limits, wearThresholds)
+		}
+	}
+}
@@ -12,7 +12,13 @@ import (
 	"github.com/home-assistant/os-agent/apparmor"
 	"github.com/home-assistant/os-agent/boards"
 	"github.com/home-assistant/os-agent/cgroup"
+	"github.com/home-assistant/os-agent/config"
+	"github.com/home-assistant/os-agent/config/coredump"
+	"github.com/home-assistant/os-agent/config/history"
+	"github.com/home-assistant/os-agent/config/logind"
+	"github.com/home-assistant/os-agent/config/resolved"
 	"github.com/home-assistant/os-agent/config/swap"
+	"github.com/home-assistant/os-agent/config/sysctl"
 	"github.com/home-assistant/os-agent/config/timesyncd"
 	"github.com/home-assistant/os-agent/datadisk"
 	"github.com/home-assistant/os-agent/system"
@@ -67,13 +73,19 @@ func main() {
 	InitializeDBus(conn)
 
 	logging.Info.Printf("Listening on service %s ...", busName)
+	history.InitializeDBus(conn)
 	datadisk.InitializeDBus(conn)
 	system.InitializeDBus(conn)
 	apparmor.InitializeDBus(conn)
 	cgroup.InitializeDBus(conn)
 	boards.InitializeDBus(conn, board)
 	swap.InitializeDBus(conn)
+	sysctl.InitializeDBus(conn)
 	timesyncd.InitializeDBus(conn)
+	resolved.InitializeDBus(conn)
+	logind.InitializeDBus(conn)
+	coredump.InitializeDBus(conn)
+	config.InitializeDBus(conn, board)
 
 	_, err = daemon.SdNotify(false, daemon.SdNotifyReady)
 	if err != nil {
@@ -14,6 +14,7 @@ import (
 	"github.com/natefinch/atomic"
 	"golang.org/x/crypto/ssh"
 
+	"github.com/home-assistant/os-agent/utils/filehistory"
 	logging "github.com/home-assistant/os-agent/utils/log"
 )
 
@@ -101,6 +102,20 @@ func validateSSHAuthKey(newKey string) (string, error) {
 	return key, nil
 }
 
+// writeSSHAuthKeys replaces the content of the authorized_keys file.
+func writeSSHAuthKeys(path string, content []byte) error {
+	if err := atomic.WriteFile(path, bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("failed to write SSH authorized keys file: %w", err)
+	}
+	// atomic.WriteFile keeps the permissions of an existing file, so tighten
+	// them explicitly (files created before this change were 0644).
+	if err := os.Chmod(path, 0o600); err != nil {
+		return fmt.Errorf("failed to set SSH authorized keys file permissions: %w", err)
+	}
+
+	return nil
+}
+
 func addSSHAuthKey(path string, newKey string) error {
 	key, err := validateSSHAuthKey(newKey)
 	if err != nil {
@@ -124,20 +139,14 @@ func addSSHAuthKey(path string, newKey string) error {
 	content = append(content, key...)
 	content = append(content, '\n')
 
-	if err := atomic.WriteFile(path, bytes.NewReader(content)); err != nil {
-		return fmt.Errorf("failed to write SSH authorized keys file: %w", err)
-	}
-	// atomic.WriteFile keeps the permissions of an existing file, so tighten
-	// them explicitly (files created before this change were 0644).
-	if err := os.Chmod(path, 0o600); err != nil {
-		return fmt.Errorf("failed to set SSH authorized keys file permissions: %w", err)
-	}
-
-	return nil
+	return writeSSHAuthKeys(path, content)
 }
 
-func (d system) AddSSHAuthKey(newKey string) *dbus.Error {
-	if err := addSSHAuthKey(sshAuthKeyFileName, newKey); err != nil {
+func (d system) AddSSHAuthKey(sender dbus.Sender, newKey string) *dbus.Error {
+	err := filehistory.Track(string(sender), []string{sshAuthKeyFileName}, func() error {
+		return addSSHAuthKey(sshAuthKeyFileName, newKey)
+	})
+	if err != nil {
 		logging.Error.Printf("Failed to add SSH authorized key: %s", err)
 		return dbus.MakeFailedError(err)
 	}
@@ -151,6 +160,9 @@ func clearSSHAuthKeys(path string) error {
 	sshAuthKeyMu.Lock()
 	defer sshAuthKeyMu.Unlock()
 
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
 	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
 		return err
 	}
@@ -158,8 +170,11 @@ func clearSSHAuthKeys(path string) error {
 	return nil
 }
 
-func (d system) ClearSSHAuthKeys() *dbus.Error {
-	if err := clearSSHAuthKeys(sshAuthKeyFileName); err != nil {
+func (d system) ClearSSHAuthKeys(sender dbus.Sender) *dbus.Error {
+	err := filehistory.Track(string(sender), []string{sshAuthKeyFileName}, func() error {
+		return clearSSHAuthKeys(sshAuthKeyFileName)
+	})
+	if err != nil {
 		logging.Error.Printf("Failed to delete SSH authentication file %s: %s", sshAuthKeyFileName, err)
 		return dbus.MakeFailedError(err)
 	}
@@ -167,6 +182,82 @@ func (d system) ClearSSHAuthKeys() *dbus.Error {
 	return nil
 }
 
+// readSSHAuthKeys returns the keys of an authorized_keys file, skipping blank
+// lines and comments. A missing file has no keys.
+func readSSHAuthKeys(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+
+	return keys, nil
+}
+
+// replaceSSHAuthKeys validates all keys before replacing the content of the
+// authorized_keys file with them. Without keys the file is removed.
+func replaceSSHAuthKeys(path string, newKeys []string) error {
+	keys := make([]string, 0, len(newKeys))
+	for _, newKey := range newKeys {
+		key, err := validateSSHAuthKey(newKey)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return clearSSHAuthKeys(path)
+	}
+
+	sshAuthKeyMu.Lock()
+	defer sshAuthKeyMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create SSH configuration directory: %w", err)
+	}
+
+	return writeSSHAuthKeys(path, []byte(strings.Join(keys, "\n")+"\n"))
+}
+
+// SSHAuthKeys returns the authorized SSH keys of the root user.
+func SSHAuthKeys() ([]string, error) {
+	sshAuthKeyMu.Lock()
+	defer sshAuthKeyMu.Unlock()
+
+	return readSSHAuthKeys(sshAuthKeyFileName)
+}
+
+// SSHAuthKeysFile returns the authorized_keys file of the root user.
+func SSHAuthKeysFile() string {
+	return sshAuthKeyFileName
+}
+
+// ValidateSSHAuthKeys checks keys the way AddSSHAuthKey does.
+func ValidateSSHAuthKeys(keys []string) error {
+	for _, key := range keys {
+		if _, err := validateSSHAuthKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceSSHAuthKeys replaces the authorized SSH keys of the root user.
+func ReplaceSSHAuthKeys(keys []string) error {
+	return replaceSSHAuthKeys(sshAuthKeyFileName, keys)
+}
+
 func (d system) MigrateDockerStorageDriver(backend string) *dbus.Error {
 	switch backend {
 	case "overlayfs":
@@ -188,6 +279,7 @@ func InitializeDBus(conn *dbus.Conn) {
 	d := system{
 		conn: conn,
 	}
+	filehistory.Manage(sshAuthKeyFileName)
 
 	err := conn.Export(d, objectPath, ifaceName)
 	if err != nil {
@@ -7,6 +7,8 @@ import (
 	"strings"
 	"sync"
 	"testing"
+
+	"github.com/home-assistant/os-agent/utils/filehistory"
 )
 
 const (
@@ -241,3 +243,117 @@ func TestAddSSHAuthKeyTightensPermissions(t *testing.T) {
 		t.Errorf("expected file mode 0600, got %o", info.Mode().Perm())
 	}
 }
+
+func TestReadSSHAuthKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+
+	keys, err := readSSHAuthKeys(path)
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("expected no keys for a missing file, got %v, %v", keys, err)
+	}
+
+	content := "# comment\n" + testKeyEd25519 + "\n\n  " + testKeyEcdsa + "  \n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to create authorized keys file: %s", err)
+	}
+
+	keys, err = readSSHAuthKeys(path)
+	if err != nil {
+		t.Fatalf("failed to read keys: %s", err)
+	}
+	if len(keys) != 2 || keys[0] != testKeyEd25519 || keys[1] != testKeyEcdsa {
+		t.Errorf("unexpected keys %q", keys)
+	}
+}
+
+func TestReplaceSSHAuthKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	if err := os.WriteFile(path, []byte(testKeyEd25519+"\n"), 0o644); err != nil { //nolint:gosec
+		t.Fatalf("failed to create authorized keys file: %s", err)
+	}
+
+	if err := replaceSSHAuthKeys(path, []string{testKeyEcdsa, testKeyRSA}); err != nil {
+		t.Fatalf("failed to replace keys: %s", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read authorized keys file: %s", err)
+	}
+	if string(content) != testKeyEcdsa+"\n"+testKeyRSA+"\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected file mode 0600, got %o", info.Mode().Perm())
+	}
+}
+
+func TestReplaceSSHAuthKeysInvalidKeyLeavesFileUntouched(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	if err := os.WriteFile(path, []byte(testKeyEd25519+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to create authorized keys file: %s", err)
+	}
+
+	if err := replaceSSHAuthKeys(path, []string{testKeyEcdsa, "not a key"}); err == nil {
+		t.Fatal("expected an error for an invalid key")
+	}
+
+	content, _ := os.ReadFile(path)
+	if string(content) != testKeyEd25519+"\n" {
+		t.Errorf("expected file to be untouched, got %q", content)
+	}
+}
+
+func TestReplaceSSHAuthKeysEmptyRemovesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	if err := os.WriteFile(path, []byte(testKeyEd25519+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to create authorized keys file: %s", err)
+	}
+
+	if err := replaceSSHAuthKeys(path, []string{}); err != nil {
+		t.Fatalf("failed to replace keys: %s", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected authorized keys file to be removed, got %v", err)
+	}
+}
+
+func TestSSHAuthKeyChangesAreRecorded(t *testing.T) {
+	filehistory.Enable(t.TempDir())
+	t.Cleanup(func() { filehistory.Enable("") })
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+
+	// Run the changes like the D-Bus methods do
+	changes := []func() error{
+		func() error { return addSSHAuthKey(path, testKeyEd25519) },
+		func() error { return replaceSSHAuthKeys(path, []string{testKeyEcdsa}) },
+		func() error { return clearSSHAuthKeys(path) },
+	}
+	for _, change := range changes {
+		if err := filehistory.Track(":1.42", []string{path}, change); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := filehistory.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Caller != ":1.42" {
+		t.Fatalf("expected 3 recorded changes, got %+v", entries)
+	}
+
+	// Undo clearing the keys
+	if err := filehistory.Rollback(path, entries[2].Revision); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != testKeyEcdsa+"\n" {
+		t.Errorf("unexpected content after rollback %q", content)
+	}
+}
@@ -0,0 +1,280 @@
+package udisks2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// ErrHealthUnsupported is returned if a drive provides no health data.
+var ErrHealthUnsupported = errors.New("drive provides no health data")
+
+// SMART attribute units as reported by UDisks2.
+var smartUnits = []string{"unknown", "none", "ms", "mK", "sectors"}
+
+// SmartAttribute is an ATA SMART attribute.
+type SmartAttribute struct {
+	ID        byte
+	Name      string
+	Flags     uint16
+	Value     int32
+	Worst     int32
+	Threshold int32
+	// Pretty is the interpreted raw value in Unit
+	Pretty int64
+	Unit   string
+}
+
+// AtaHealth is the SMART data of an ATA drive.
+type AtaHealth struct {
+	Enabled bool
+	Failing bool
+	// Updated is the time of the last SMART data refresh in seconds since
+	// the epoch
+	Updated        uint64
+	PowerOnSeconds uint64
+	// Temperature in Kelvin, 0 if unknown
+	Temperature             float64
+	NumAttributesFailing    int32
+	NumAttributesFailedPast int32
+	NumBadSectors           int64
+	SelftestStatus          string
+	// SelftestPercentRemaining is -1 if no self-test is running
+	SelftestPercentRemaining int32
+	Attributes               []SmartAttribute
+}
+
+// driveObject returns the drive object backing a disk.
+func (u UDisks2Helper) driveObject(devicePath string) (dbus.BusObject, error) {
+	busObject, err := u.resolveDevice(devicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	drivePath, err := NewBlock(busObject).GetDrive(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if drivePath == "/" {
+		return nil, fmt.Errorf("device %s is not backed by a drive", devicePath)
+	}
+
+	return u.conn.Object("org.freedesktop.UDisks2", drivePath), nil
+}
+
+func (u UDisks2Helper) ataDrive(devicePath string) (*DriveAta, error) {
+	driveObject, err := u.driveObject(devicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	ata := NewDriveAta(driveObject)
+	supported, err := ata.GetSmartSupported(context.Background())
+	if err != nil || !supported {
+		// Drives which aren't ATA don't implement the interface at all
+		return nil, ErrHealthUnsupported
+	}
+
+	return ata, nil
+}
+
+// GetAtaHealth returns the SMART data of the drive backing a disk, or
+// ErrHealthUnsupported if it is no ATA drive or doesn't support SMART.
+func (u UDisks2Helper) GetAtaHealth(devicePath string) (AtaHealth, error) {
+	ctx := context.Background()
+	ata, err := u.ataDrive(devicePath)
+	if err != nil {
+		return AtaHealth{}, err
+	}
+
+	var health AtaHealth
+	if health.Enabled, err = ata.GetSmartEnabled(ctx); err != nil {
+		return AtaHealth{}, err
+	}
+	if !health.Enabled {
+		return health, nil
+	}
+
+	if health.Failing, err = ata.GetSmartFailing(ctx); err != nil {
+		return AtaHealth{}, err
+	}
+	if health.Updated, err = ata.GetSmartUpdated(ctx); err != nil {
+		return AtaHealth{}, err
+	}
+	if health.PowerOnSeconds, err = ata.GetSmartPowerOnSeconds(ctx); err != nil {
+		return AtaHealth{}, err
+	}
+	if health.Temperature, err = ata.GetSmartTemperature(ctx); err != nil {
+		return AtaHealth{}, err
+	}
+	if health.NumAttributesFailing, err = ata.GetSmartNumAttributesFailing(ctx); err != nil {
+		return AtaHealth{}, err
+	}
+	if health.NumAttributesFailedPast, err = ata.GetSmartNumAttributesFailedInThePast(ctx); err != nil {
+		return AtaHealth{}, err
+	}
+	if health.NumBadSectors, err = ata.GetSmartNumBadSectors(ctx); err != nil {
+		return AtaHealth{}, err
+	}
+	if health.SelftestStatus, err = ata.GetSmartSelftestStatus(ctx); err != nil {
+		return AtaHealth{}, err
+	}
+	if health.SelftestPercentRemaining, err = ata.GetSmartSelftestPercentRemaining(ctx); err != nil {
+		return AtaHealth{}, err
+	}
+
+	attributes, err := ata.SmartGetAttributes(ctx, noOptions)
+	if err != nil {
+		return AtaHealth{}, err
+	}
+	for _, attribute := range attributes {
+		unit := smartUnits[0]
+		if attribute.V7 >= 0 && int(attribute.V7) < len(smartUnits) {
+			unit = smartUnits[attribute.V7]
+		}
+		health.Attributes = append(health.Attributes, SmartAttribute{
+			ID:        attribute.V0,
+			Name:      attribute.V1,
+			Flags:     attribute.V2,
+			Value:     attribute.V3,
+			Worst:     attribute.V4,
+			Threshold: attribute.V5,
+			Pretty:    attribute.V6,
+			Unit:      unit,
+		})
+	}
+
+	return health, nil
+}
+
+// StartAtaSelfTest starts a SMART self-test of the given type ("short",
+// "extended" or "conveyance") on the drive backing a disk.
+func (u UDisks2Helper) StartAtaSelfTest(devicePath string, testType string) error {
+	ata, err := u.ataDrive(devicePath)
+	if err != nil {
+		return err
+	}
+
+	return ata.SmartSelftestStart(context.Background(), testType, noOptions)
+}
+
+// AbortAtaSelfTest aborts the running SMART self-test on the drive backing
+// a disk.
+func (u UDisks2Helper) AbortAtaSelfTest(devicePath string) error {
+	ata, err := u.ataDrive(devicePath)
+	if err != nil {
+		return err
+	}
+
+	return ata.SmartSelftestAbort(context.Background(), noOptions)
+}
+
+// NvmeHealth is the SMART/health information of an NVMe controller.
+type NvmeHealth struct {
+	State string
+	// Updated is the time of the last SMART data refresh in seconds since
+	// the epoch
+	Updated uint64
+	// CriticalWarnings are the critical warnings set by the controller, e.g.
+	// "spare", "temperature", "degraded" or "readonly"
+	CriticalWarnings []string
+	PowerOnHours     uint64
+	// Temperature in Kelvin, 0 if unknown
+	Temperature              uint16
+	SelftestStatus           string
+	SelftestPercentRemaining int32
+	PercentUsed              byte
+	AvailableSpare           byte
+	SpareThreshold           byte
+	MediaErrors              uint64
+	// BytesWritten is the amount of data written by the host
+	BytesWritten    uint64
+	BytesRead       uint64
+	UnsafeShutdowns uint64
+}
+
+func (u UDisks2Helper) nvmeController(devicePath string) (*NVMeController, error) {
+	driveObject, err := u.driveObject(devicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	controller := NewNVMeController(driveObject)
+	if _, err := controller.GetState(context.Background()); err != nil {
+		// Drives which aren't NVMe don't implement the interface at all
+		return nil, ErrHealthUnsupported
+	}
+
+	return controller, nil
+}
+
+// GetNvmeHealth returns the SMART/health information of the NVMe controller
+// backing a disk, or ErrHealthUnsupported if it is no NVMe drive.
+func (u UDisks2Helper) GetNvmeHealth(devicePath string) (NvmeHealth, error) {
+	ctx := context.Background()
+	controller, err := u.nvmeController(devicePath)
+	if err != nil {
+		return NvmeHealth{}, err
+	}
+
+	var health NvmeHealth
+	if health.State, err = controller.GetState(ctx); err != nil {
+		return NvmeHealth{}, err
+	}
+	if health.Updated, err = controller.GetSmartUpdated(ctx); err != nil {
+		return NvmeHealth{}, err
+	}
+	if health.CriticalWarnings, err = controller.GetSmartCriticalWarning(ctx); err != nil {
+		return NvmeHealth{}, err
+	}
+	if health.PowerOnHours, err = controller.GetSmartPowerOnHours(ctx); err != nil {
+		return NvmeHealth{}, err
+	}
+	if health.Temperature, err = controller.GetSmartTemperature(ctx); err != nil {
+		return NvmeHealth{}, err
+	}
+	if health.SelftestStatus, err = controller.GetSmartSelftestStatus(ctx); err != nil {
+		return NvmeHealth{}, err
+	}
+	if health.SelftestPercentRemaining, err = controller.GetSmartSelftestPercentRemaining(ctx); err != nil {
+		return NvmeHealth{}, err
+	}
+
+	attributes, err := controller.SmartGetAttributes(ctx, noOptions)
+	if err != nil {
+		return NvmeHealth{}, err
+	}
+	health.PercentUsed, _ = attributes["percent_used"].Value().(byte)
+	health.AvailableSpare, _ = attributes["avail_spare"].Value().(byte)
+	health.SpareThreshold, _ = attributes["spare_thresh"].Value().(byte)
+	health.MediaErrors, _ = attributes["media_errors"].Value().(uint64)
+	health.BytesWritten, _ = attributes["total_data_written"].Value().(uint64)
+	health.BytesRead, _ = attributes["total_data_read"].Value().(uint64)
+	health.UnsafeShutdowns, _ = attributes["unsafe_shutdowns"].Value().(uint64)
+
+	return health, nil
+}
+
+// StartNvmeSelfTest starts a device self-test of the given type ("short",
+// "extended" or "vendor-specific") on the NVMe controller backing a disk.
+func (u UDisks2Helper) StartNvmeSelfTest(devicePath string, testType string) error {
+	controller, err := u.nvmeController(devicePath)
+	if err != nil {
+		return err
+	}
+
+	return controller.SmartSelftestStart(context.Background(), testType, noOptions)
+}
+
+// AbortNvmeSelfTest aborts the running device self-test on the NVMe
+// controller backing a disk.
+func (u UDisks2Helper) AbortNvmeSelfTest(devicePath string) error {
+	controller, err := u.nvmeController(devicePath)
+	if err != nil {
+		return err
+	}
+
+	return controller.SmartSelftestAbort(context.Background(), noOptions)
+}
@@ -57,6 +57,17 @@ func (u UDisks2Helper) GetRootDeviceFromLabel(label string) (*string, error) {
 	return parentBlock.GetDeviceString(context.Background())
 }
 
+// GetPartitionUUIDFromLabel returns the GPT partition UUID (PARTUUID) of the
+// partition holding the file system with the given label.
+func (u UDisks2Helper) GetPartitionUUIDFromLabel(label string) (string, error) {
+	busObject, err := u.GetBusObjectFromLabel(label)
+	if err != nil {
+		return "", err
+	}
+
+	return NewPartition(busObject).GetUUID(context.Background())
+}
+
 func (u UDisks2Helper) FormatPartition(blockObjectPath dbus.BusObject, fsType string, label string) error {
 	parentBlock := NewBlock(blockObjectPath)
 	formatOptions := map[string]dbus.Variant{"label": dbus.MakeVariant(label)}
@@ -123,3 +134,251 @@ func (u UDisks2Helper) PartitionDeviceWithSinglePartition(devicePath string, uui
 
 	return nil
 }
+
+// DiskInfo describes a whole disk along with the file systems on it.
+type DiskInfo struct {
+	Device        string
+	Vendor        string
+	Model         string
+	Serial        string
+	ConnectionBus string
+	Size          uint64
+	Removable     bool
+	ReadOnly      bool
+	// Labels of the file systems on the disk and its partitions
+	Labels []string
+	// MountPoints of the file systems on the disk and its partitions
+	MountPoints []string
+}
+
+// ListDisks returns all block devices backed by a drive which are not
+// partitions, e.g. no loop or zram devices.
+func (u UDisks2Helper) ListDisks() ([]DiskInfo, error) {
+	ctx := context.Background()
+	blockObjects, err := u.manager.GetBlockDevices(ctx, noOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	disks := map[dbus.ObjectPath]*DiskInfo{}
+	var order []dbus.ObjectPath
+	children := map[dbus.ObjectPath][]dbus.ObjectPath{}
+
+	for _, blockObjectPath := range blockObjects {
+		busObject := u.conn.Object("org.freedesktop.UDisks2", blockObjectPath)
+
+		// Partitions are accounted to the disk holding their table
+		if table, err := NewPartition(busObject).GetTable(ctx); err == nil {
+			children[table] = append(children[table], blockObjectPath)
+			continue
+		}
+
+		block := NewBlock(busObject)
+		drivePath, err := block.GetDrive(ctx)
+		if err != nil || drivePath == "/" {
+			continue
+		}
+
+		disk, err := u.readDisk(ctx, block, drivePath)
+		if err != nil {
+			logging.Warning.Printf("Failed to read disk %s: %s", blockObjectPath, err)
+			continue
+		}
+		disks[blockObjectPath] = disk
+		order = append(order, blockObjectPath)
+	}
+
+	result := make([]DiskInfo, 0, len(order))
+	for _, diskPath := range order {
+		disk := disks[diskPath]
+		for _, blockObjectPath := range append([]dbus.ObjectPath{diskPath}, children[diskPath]...) {
+			label, mountPoints := u.readFilesystem(ctx, blockObjectPath)
+			if label != "" {
+				disk.Labels = append(disk.Labels, label)
+			}
+			disk.MountPoints = append(disk.MountPoints, mountPoints...)
+		}
+		result = append(result, *disk)
+	}
+
+	return result, nil
+}
+
+func (u UDisks2Helper) readDisk(ctx context.Context, block *Block, drivePath dbus.ObjectPath) (*DiskInfo, error) {
+	device, err := block.GetDeviceString(ctx)
+	if err != nil {
+		return nil, err
+	}
+	size, err := block.GetSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	readOnly, err := block.GetReadOnly(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	drive := NewDrive(u.conn.Object("org.freedesktop.UDisks2", drivePath))
+	disk := &DiskInfo{Device: *device, Size: size, ReadOnly: readOnly}
+	if disk.Vendor, err = drive.GetVendor(ctx); err != nil {
+		return nil, err
+	}
+	if disk.Model, err = drive.GetModel(ctx); err != nil {
+		return nil, err
+	}
+	if disk.Serial, err = drive.GetSerial(ctx); err != nil {
+		return nil, err
+	}
+	if disk.ConnectionBus, err = drive.GetConnectionBus(ctx); err != nil {
+		return nil, err
+	}
+	if disk.Removable, err = drive.GetRemovable(ctx); err != nil {
+		return nil, err
+	}
+
+	return disk, nil
+}
+
+// readFilesystem returns the label and mount points of the file system on a
+// block device. Block devices without a file system have neither.
+func (u UDisks2Helper) readFilesystem(ctx context.Context, blockObjectPath dbus.ObjectPath) (string, []string) {
+	busObject := u.conn.Object("org.freedesktop.UDisks2", blockObjectPath)
+
+	label, err := NewBlock(busObject).GetIdLabel(ctx)
+	if err != nil {
+		label = ""
+	}
+
+	mountPoints, err := NewFilesystem(busObject).GetMountPointsString(ctx)
+	if err != nil {
+		return label, nil
+	}
+
+	return label, mountPoints
+}
+
+// resolveDevice returns the block device object of a device path.
+func (u UDisks2Helper) resolveDevice(devicePath string) (dbus.BusObject, error) {
+	devspec := map[string]dbus.Variant{"path": dbus.MakeVariant(devicePath)}
+	blockObjects, err := u.manager.ResolveDevice(context.Background(), devspec, noOptions)
+	if err != nil {
+		return nil, err
+	}
+	if len(blockObjects) != 1 {
+		return nil, fmt.Errorf("expected single block device with device path \"%s\", found %d", devicePath, len(blockObjects))
+	}
+
+	return u.conn.Object("org.freedesktop.UDisks2", blockObjects[0]), nil
+}
+
+// RescanDevice makes the kernel re-read the partition table of a device.
+func (u UDisks2Helper) RescanDevice(devicePath string) error {
+	busObject, err := u.resolveDevice(devicePath)
+	if err != nil {
+		return err
+	}
+
+	return NewBlock(busObject).Rescan(context.Background(), noOptions)
+}
+
+// PartitionInfo describes a partition of a disk.
+type PartitionInfo struct {
+	Device string
+	// Name is the GPT partition name (PARTLABEL)
+	Name string
+	// UUID is the GPT partition UUID (PARTUUID)
+	UUID   string
+	Type   string
+	Offset uint64
+	Size   uint64
+	// MountPoints of the file system on the partition
+	MountPoints []string
+}
+
+// ListPartitions returns the partitions in the partition table of a disk.
+func (u UDisks2Helper) ListPartitions(devicePath string) ([]PartitionInfo, error) {
+	ctx := context.Background()
+	busObject, err := u.resolveDevice(devicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionObjects, err := NewPartitionTable(busObject).GetPartitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make([]PartitionInfo, 0, len(partitionObjects))
+	for _, partitionObject := range partitionObjects {
+		partitionBusObject := u.conn.Object("org.freedesktop.UDisks2", partitionObject)
+		partition := NewPartition(partitionBusObject)
+
+		var info PartitionInfo
+		device, err := NewBlock(partitionBusObject).GetDeviceString(ctx)
+		if err != nil {
+			return nil, err
+		}
+		info.Device = *device
+		if info.Name, err = partition.GetName(ctx); err != nil {
+			return nil, err
+		}
+		if info.UUID, err = partition.GetUUID(ctx); err != nil {
+			return nil, err
+		}
+		if info.Type, err = partition.GetType(ctx); err != nil {
+			return nil, err
+		}
+		if info.Offset, err = partition.GetOffset(ctx); err != nil {
+			return nil, err
+		}
+		if info.Size, err = partition.GetSize(ctx); err != nil {
+			return nil, err
+		}
+		_, info.MountPoints = u.readFilesystem(ctx, partitionObject)
+		partitions = append(partitions, info)
+	}
+
+	return partitions, nil
+}
+
+// CreatePartition adds a partition to the existing partition table of a disk.
+func (u UDisks2Helper) CreatePartition(devicePath string, offset uint64, size uint64, uuid string, name string) error {
+	busObject, err := u.resolveDevice(devicePath)
+	if err != nil {
+		return err
+	}
+
+	logging.Info.Printf("Creating partition %s on device %s at offset %d with %d bytes.", name, devicePath, offset, size)
+	createdPartition, err := NewPartitionTable(busObject).CreatePartition(context.Background(), offset, size, uuid, name, noOptions)
+	if err != nil {
+		return err
+	}
+	logging.Info.Printf("New partition D-Bus object %s.", createdPartition)
+
+	return nil
+}
+
+// SetPartitionTypeAndName changes type and GPT name of an existing partition.
+func (u UDisks2Helper) SetPartitionTypeAndName(devicePath string, uuid string, name string) error {
+	busObject, err := u.resolveDevice(devicePath)
+	if err != nil {
+		return err
+	}
+
+	partition := NewPartition(busObject)
+	if err := partition.SetType(context.Background(), uuid, noOptions); err != nil {
+		return err
+	}
+	return partition.SetName(context.Background(), name, noOptions)
+}
+
+// DeletePartition removes a partition from the partition table of its disk.
+func (u UDisks2Helper) DeletePartition(devicePath string) error {
+	busObject, err := u.resolveDevice(devicePath)
+	if err != nil {
+		return err
+	}
+
+	logging.Info.Printf("Deleting partition %s.", devicePath)
+	return NewPartition(busObject).Delete(context.Background(), noOptions)
+}
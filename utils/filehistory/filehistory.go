@@ -0,0 +1,400 @@
+package filehistory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+	"github.com/natefinch/atomic"
+
+	logging "github.com/home-assistant/os-agent/utils/log"
+)
+
+const (
+	indexName = "index.json"
+	// MaxRevisions is the number of previous versions kept per file.
+	MaxRevisions = 10
+)
+
+var (
+	// storePath is where previous versions of managed files are kept,
+	// recording is disabled until it is set with Enable.
+	storePath string
+	// historyMu serializes all access to the store.
+	historyMu sync.Mutex
+	// managed are the files written on behalf of D-Bus clients, only they
+	// may be rolled back. Guarded by historyMu.
+	managed = map[string]bool{}
+	// fileLocks serialize the changes of each file, so they are attributed
+	// to the right caller. Guarded by fileLocksMu.
+	fileLocks   = map[string]*sync.Mutex{}
+	fileLocksMu sync.Mutex
+
+	ErrUnknownRevision = errors.New("unknown revision")
+	ErrUnmanagedFile   = errors.New("file is not managed by the agent")
+)
+
+// Entry describes a change of a managed file. The stored revision holds the
+// content the file had before the change.
+type Entry struct {
+	File     string
+	Revision uint32
+	// Time of the change in seconds since the epoch
+	Time int64
+	// Caller is the D-Bus client which requested the change, "rollback" for
+	// rollbacks
+	Caller string
+	// Existed is false if the file was created by the change
+	Existed bool
+}
+
+func fileDir(path string) string {
+	return filepath.Join(storePath, url.PathEscape(path))
+}
+
+func revisionPath(path string, revision uint32) string {
+	return filepath.Join(fileDir(path), strconv.FormatUint(uint64(revision), 10))
+}
+
+func loadIndex(path string) ([]Entry, error) {
+	content, err := os.ReadFile(filepath.Join(fileDir(path), indexName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("corrupt history index of %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+func saveIndex(path string, entries []Entry) error {
+	content, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return atomic.WriteFile(filepath.Join(fileDir(path), indexName), bytes.NewReader(content))
+}
+
+// version is the content of a file at some point, nil if it did not exist.
+type version struct {
+	path    string
+	content []byte
+}
+
+func readVersion(path string) (version, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return version{path: path}, nil
+	} else if err != nil {
+		return version{}, err
+	}
+	if content == nil {
+		content = []byte{}
+	}
+	return version{path: path, content: content}, nil
+}
+
+func (v version) equal(other version) bool {
+	return (v.content == nil) == (other.content == nil) && bytes.Equal(v.content, other.content)
+}
+
+// Snapshot holds the content of files at one point in time.
+type Snapshot []version
+
+// TakeSnapshot reads the current content of files, which may not exist.
+func TakeSnapshot(files []string) (Snapshot, error) {
+	snapshot := make(Snapshot, 0, len(files))
+	for _, path := range files {
+		v, err := readVersion(path)
+		if err != nil {
+			return nil, err
+		}
+		snapshot = append(snapshot, v)
+	}
+	return snapshot, nil
+}
+
+// Restore writes the files back byte for byte, files which did not exist are
+// removed. Files which are unchanged are left untouched.
+func (s Snapshot) Restore() error {
+	var errs []error
+	for _, v := range s {
+		current, err := readVersion(v.path)
+		if err == nil && current.equal(v) {
+			continue
+		}
+
+		if v.content == nil {
+			err = os.Remove(v.path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			err = atomic.WriteFile(v.path, bytes.NewReader(v.content))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %s: %w", v.path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// record stores v as the version of its file before the change by caller.
+func record(v version, caller string) error {
+	entries, err := loadIndex(v.path)
+	if err != nil {
+		return err
+	}
+
+	var revision uint32 = 1
+	if len(entries) > 0 {
+		revision = entries[len(entries)-1].Revision + 1
+	}
+
+	if err := os.MkdirAll(fileDir(v.path), 0o700); err != nil {
+		return err
+	}
+	if v.content != nil {
+		if err := atomic.WriteFile(revisionPath(v.path, revision), bytes.NewReader(v.content)); err != nil {
+			return err
+		}
+	}
+
+	entries = append(entries, Entry{
+		File:     v.path,
+		Revision: revision,
+		Time:     time.Now().Unix(),
+		Caller:   caller,
+		Existed:  v.content != nil,
+	})
+	for len(entries) > MaxRevisions {
+		_ = os.Remove(revisionPath(v.path, entries[0].Revision))
+		entries = entries[1:]
+	}
+
+	return saveIndex(v.path, entries)
+}
+
+// Enable starts recording changes into the directory at path.
+func Enable(path string) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	storePath = path
+}
+
+// Manage registers files the agent writes on behalf of D-Bus clients, so
+// their recorded changes can be rolled back.
+func Manage(files ...string) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	for _, path := range files {
+		managed[path] = true
+	}
+}
+
+func lockFiles(files []string) func() {
+	sorted := slices.Clone(files)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	fileLocksMu.Lock()
+	locks := make([]*sync.Mutex, 0, len(sorted))
+	for _, path := range sorted {
+		if fileLocks[path] == nil {
+			fileLocks[path] = &sync.Mutex{}
+		}
+		locks = append(locks, fileLocks[path])
+	}
+	fileLocksMu.Unlock()
+
+	for _, lock := range locks {
+		lock.Lock()
+	}
+	return func() {
+		for _, lock := range locks {
+			lock.Unlock()
+		}
+	}
+}
+
+// Track runs fn on behalf of caller, the D-Bus client requesting a change,
+// and records the previous version of each of files which fn modified. The
+// files become managed. Calls for the same files are serialized, fn must not
+// call Track itself.
+func Track(caller string, files []string, fn func() error) error {
+	Manage(files...)
+
+	unlock := lockFiles(files)
+	defer unlock()
+
+	previous, err := TakeSnapshot(files)
+	if err != nil {
+		return err
+	}
+
+	fnErr := fn()
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	if storePath == "" {
+		return fnErr
+	}
+	for _, v := range previous {
+		current, err := readVersion(v.path)
+		if err == nil && current.equal(v) {
+			continue
+		}
+		if err := record(v, caller); err != nil {
+			logging.Warning.Printf("Failed to record previous version of %s: %s", v.path, err)
+		}
+	}
+
+	return fnErr
+}
+
+// properties is the org.freedesktop.DBus.Properties handler of an object,
+// attributing changes made by property writes to the client setting them.
+type properties struct {
+	props *prop.Properties
+	files []string
+}
+
+func (p properties) Get(iface string, property string) (dbus.Variant, *dbus.Error) {
+	return p.props.Get(iface, property)
+}
+
+func (p properties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	return p.props.GetAll(iface)
+}
+
+func (p properties) Set(sender dbus.Sender, iface string, property string, value dbus.Variant) *dbus.Error {
+	var dbusErr *dbus.Error
+	_ = Track(string(sender), p.files, func() error {
+		dbusErr = p.props.Set(iface, property, value)
+		return nil
+	})
+	return dbusErr
+}
+
+// ExportProperties replaces the properties handler exported by prop.Export,
+// so changes of files made by property callbacks are attributed to the
+// client setting the property.
+func ExportProperties(conn *dbus.Conn, path dbus.ObjectPath, props *prop.Properties, files []string) error {
+	Manage(files...)
+	return conn.Export(properties{props: props, files: files}, path, "org.freedesktop.DBus.Properties")
+}
+
+// List returns the recorded changes of all managed files, oldest first.
+func List() ([]Entry, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	if storePath == "" {
+		return []Entry{}, nil
+	}
+	dirs, err := os.ReadDir(storePath)
+	if os.IsNotExist(err) {
+		return []Entry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	all := []Entry{}
+	for _, dir := range dirs {
+		path, err := url.PathUnescape(dir.Name())
+		if err != nil || !dir.IsDir() {
+			continue
+		}
+
+		entries, err := loadIndex(path)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, entries...)
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Time < all[j].Time
+	})
+
+	return all, nil
+}
+
+// Rollback restores path to the content it had before the given change. The
+// current version is recorded first, so a rollback can be undone as well.
+// Only managed files can be rolled back.
+func Rollback(path string, revision uint32) error {
+	historyMu.Lock()
+	isManaged := managed[path]
+	historyMu.Unlock()
+	if !isManaged {
+		return fmt.Errorf("%w: %s", ErrUnmanagedFile, path)
+	}
+
+	unlock := lockFiles([]string{path})
+	defer unlock()
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	if storePath == "" {
+		return fmt.Errorf("%w %d of %s", ErrUnknownRevision, revision, path)
+	}
+	entries, err := loadIndex(path)
+	if err != nil {
+		return err
+	}
+
+	var target *Entry
+	for i := range entries {
+		if entries[i].Revision == revision {
+			target = &entries[i]
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("%w %d of %s", ErrUnknownRevision, revision, path)
+	}
+
+	var content []byte
+	if target.Existed {
+		content, err = os.ReadFile(revisionPath(path, revision))
+		if err != nil {
+			return err
+		}
+	}
+
+	current, err := readVersion(path)
+	if err != nil {
+		return err
+	}
+	if err := record(current, "rollback"); err != nil {
+		return err
+	}
+
+	if !target.Existed {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	return atomic.WriteFile(path, bytes.NewReader(content))
+}
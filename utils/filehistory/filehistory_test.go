@@ -0,0 +1,229 @@
+package filehistory
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func setupStore(t *testing.T) string {
+	t.Helper()
+	Enable(t.TempDir())
+	t.Cleanup(func() { Enable("") })
+	return t.TempDir()
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	err := Track(":1.42", []string{path}, func() error {
+		return os.WriteFile(path, []byte(content), 0o600)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestRecordAndRollback(t *testing.T) {
+	path := filepath.Join(setupStore(t), "test.conf")
+
+	writeFile(t, path, "first\n")
+	writeFile(t, path, "second\n")
+	writeFile(t, path, "third\n")
+
+	entries, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].Existed || !entries[1].Existed {
+		t.Errorf("unexpected Existed flags: %+v", entries)
+	}
+	if entries[2].File != path || entries[2].Revision != 3 {
+		t.Errorf("unexpected entry: %+v", entries[2])
+	}
+
+	// Revision 3 holds the content before the third write
+	if err := Rollback(path, 3); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "second\n" {
+		t.Errorf("expected %q after rollback, got %q", "second\n", got)
+	}
+
+	// The rollback itself is recorded and can be undone
+	entries, _ = List()
+	last := entries[len(entries)-1]
+	if last.Caller != "rollback" || last.Revision != 4 {
+		t.Errorf("unexpected rollback entry: %+v", last)
+	}
+	if err := Rollback(path, 4); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "third\n" {
+		t.Errorf("expected %q after undo, got %q", "third\n", got)
+	}
+}
+
+func TestRollbackCreatedFile(t *testing.T) {
+	path := filepath.Join(setupStore(t), "new.conf")
+
+	writeFile(t, path, "created\n")
+	if err := Rollback(path, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", path, err)
+	}
+}
+
+func TestRollbackUnknown(t *testing.T) {
+	path := filepath.Join(setupStore(t), "test.conf")
+
+	writeFile(t, path, "first\n")
+	if err := Rollback(path, 7); !errors.Is(err, ErrUnknownRevision) {
+		t.Errorf("expected ErrUnknownRevision, got %v", err)
+	}
+	other := filepath.Join(filepath.Dir(path), "other.conf")
+	Manage(other)
+	if err := Rollback(other, 1); !errors.Is(err, ErrUnknownRevision) {
+		t.Errorf("expected ErrUnknownRevision, got %v", err)
+	}
+}
+
+func TestRollbackUnmanaged(t *testing.T) {
+	path := filepath.Join(setupStore(t), "unmanaged.conf")
+
+	// A change recorded by a previous run of the agent, for a file which is
+	// no longer written on behalf of clients
+	if err := os.WriteFile(path, []byte("keep\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	historyMu.Lock()
+	err := record(version{path: path, content: []byte("old\n")}, ":1.42")
+	historyMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Rollback(path, 1); !errors.Is(err, ErrUnmanagedFile) {
+		t.Errorf("expected ErrUnmanagedFile, got %v", err)
+	}
+	if got := readFile(t, path); got != "keep\n" {
+		t.Errorf("unmanaged file was modified: %q", got)
+	}
+}
+
+func TestMaxRevisions(t *testing.T) {
+	path := filepath.Join(setupStore(t), "test.conf")
+
+	for i := 0; i < MaxRevisions+5; i++ {
+		writeFile(t, path, strconv.Itoa(i))
+	}
+
+	entries, _ := List()
+	if len(entries) != MaxRevisions {
+		t.Fatalf("expected %d entries, got %d", MaxRevisions, len(entries))
+	}
+	if entries[0].Revision != 6 {
+		t.Errorf("expected oldest revision 6, got %d", entries[0].Revision)
+	}
+	if err := Rollback(path, 1); !errors.Is(err, ErrUnknownRevision) {
+		t.Errorf("expected pruned revision to be unknown, got %v", err)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.conf")
+
+	writeFile(t, path, "first\n")
+	entries, err := List()
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected no entries while disabled, got %v, %v", entries, err)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	dir := setupStore(t)
+	changed := filepath.Join(dir, "changed.conf")
+	unchanged := filepath.Join(dir, "unchanged.conf")
+	writeFile(t, unchanged, "same\n")
+
+	expected := errors.New("failed")
+	err := Track(":1.7", []string{changed, unchanged}, func() error {
+		if err := os.WriteFile(changed, []byte("new\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(unchanged, []byte("same\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return expected
+	})
+	if !errors.Is(err, expected) {
+		t.Errorf("expected the error of fn, got %v", err)
+	}
+
+	entries, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byFile := map[string][]Entry{}
+	for _, entry := range entries {
+		byFile[entry.File] = append(byFile[entry.File], entry)
+	}
+	if len(byFile[unchanged]) != 1 || byFile[unchanged][0].Caller != ":1.42" {
+		t.Errorf("unexpected entries of unchanged file %+v", byFile[unchanged])
+	}
+	if len(byFile[changed]) != 1 || byFile[changed][0].Caller != ":1.7" || byFile[changed][0].Existed {
+		t.Errorf("unexpected entries of changed file %+v", byFile[changed])
+	}
+}
+
+func TestTrackConcurrentCallers(t *testing.T) {
+	dir := setupStore(t)
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			caller := ":1." + strconv.Itoa(i)
+			path := filepath.Join(dir, strconv.Itoa(i%2)+".conf")
+			_ = Track(caller, []string{path}, func() error {
+				return os.WriteFile(path, []byte(caller), 0o600)
+			})
+		}()
+	}
+	wg.Wait()
+
+	// Each revision holds the content written by the caller of the previous one
+	entries, _ := List()
+	if len(entries) != 8 {
+		t.Fatalf("expected 8 entries, got %d", len(entries))
+	}
+	last := map[string]string{}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Revision < entries[j].Revision })
+	for _, entry := range entries {
+		if previous, ok := last[entry.File]; ok {
+			content, err := os.ReadFile(revisionPath(entry.File, entry.Revision))
+			if err != nil || string(content) != previous {
+				t.Errorf("revision %d of %s holds %q, expected %q", entry.Revision, entry.File, content, previous)
+			}
+		}
+		last[entry.File] = entry.Caller
+	}
+}
@@ -0,0 +1,219 @@
+package filewatch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	logging "github.com/home-assistant/os-agent/utils/log"
+)
+
+const (
+	// watchMask covers in-place writes as well as files replaced by rename,
+	// as done by atomic writes and editors.
+	// The directory itself going away is watched as well, to watch it again
+	// once it is recreated.
+	watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_CREATE |
+		syscall.IN_DELETE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM |
+		syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+	// debounceDelay groups the events of a single change, e.g. an editor
+	// writing and renaming a file, into one callback.
+	debounceDelay = 200 * time.Millisecond
+)
+
+type event struct {
+	wd   int32
+	mask uint32
+	name string
+}
+
+var (
+	fd        = -1
+	dirs      = map[int32]string{}
+	callbacks = map[string][]func(){}
+	timers    = map[string]*time.Timer{}
+	// lost are the watched directories which were removed and are waiting to
+	// be recreated.
+	lost    = map[string]bool{}
+	watchMu sync.Mutex
+
+	// rewatchInterval is how often a removed directory is checked for having
+	// been recreated, guarded by watchMu.
+	rewatchInterval = 5 * time.Second
+)
+
+// parseEvents decodes the inotify events read from the file descriptor.
+func parseEvents(buf []byte) []event {
+	var events []event
+	for len(buf) >= syscall.SizeofInotifyEvent {
+		var raw syscall.InotifyEvent
+		if err := binary.Read(bytes.NewReader(buf[:syscall.SizeofInotifyEvent]), binary.NativeEndian, &raw); err != nil {
+			break
+		}
+
+		end := syscall.SizeofInotifyEvent + int(raw.Len)
+		if end > len(buf) {
+			break
+		}
+		name := string(bytes.TrimRight(buf[syscall.SizeofInotifyEvent:end], "\x00"))
+		events = append(events, event{wd: raw.Wd, mask: raw.Mask, name: name})
+		buf = buf[end:]
+	}
+
+	return events
+}
+
+// schedule runs the callbacks of key once the events of a change settled.
+// The caller must hold watchMu.
+func schedule(key string) {
+	if len(callbacks[key]) == 0 {
+		return
+	}
+
+	if timer, ok := timers[key]; ok {
+		timer.Reset(debounceDelay)
+		return
+	}
+	timers[key] = time.AfterFunc(debounceDelay, func() {
+		watchMu.Lock()
+		delete(timers, key)
+		pending := append([]func(){}, callbacks[key]...)
+		watchMu.Unlock()
+
+		for _, callback := range pending {
+			callback()
+		}
+	})
+}
+
+// scheduleAll runs the callbacks of every watched path in dir, or of all
+// watched paths with an empty dir.
+func scheduleAll(dir string) {
+	for key := range callbacks {
+		if dir == "" || key == dir || filepath.Dir(key) == dir {
+			schedule(key)
+		}
+	}
+}
+
+func dispatch(e event) {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+
+	// Events were dropped, any watched file might have changed
+	if e.mask&syscall.IN_Q_OVERFLOW != 0 {
+		logging.Warning.Printf("File change events were lost, refreshing all watched files")
+		scheduleAll("")
+		return
+	}
+
+	dir, ok := dirs[e.wd]
+	if !ok {
+		return
+	}
+
+	switch {
+	case e.mask&syscall.IN_MOVE_SELF != 0:
+		// The watch follows the directory to its new name, drop it
+		_, _ = syscall.InotifyRmWatch(fd, uint32(e.wd)) //nolint:gosec
+	case e.mask&syscall.IN_IGNORED != 0:
+		// The watch is gone along with the directory
+		delete(dirs, e.wd)
+		scheduleAll(dir)
+		if !lost[dir] {
+			lost[dir] = true
+			go rewatch(dir)
+		}
+		return
+	}
+
+	// Callbacks are registered either for the file or its whole directory
+	for _, key := range []string{filepath.Join(dir, e.name), dir} {
+		schedule(key)
+	}
+}
+
+// rewatch watches a removed directory again once it is recreated, e.g. by an
+// OS update replacing it, and runs the callbacks for its new content.
+func rewatch(dir string) {
+	for {
+		watchMu.Lock()
+		interval := rewatchInterval
+		watchMu.Unlock()
+		time.Sleep(interval)
+
+		watchMu.Lock()
+		wd, err := syscall.InotifyAddWatch(fd, dir, watchMask)
+		if err == nil {
+			dirs[int32(wd)] = dir //nolint:gosec
+			delete(lost, dir)
+			scheduleAll(dir)
+		}
+		watchMu.Unlock()
+
+		if err == nil {
+			logging.Info.Printf("Watching recreated directory %s", dir)
+			return
+		}
+	}
+}
+
+func run(fd int) {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			logging.Error.Printf("Failed to read file change events: %s", err)
+			return
+		}
+
+		for _, e := range parseEvents(buf[:n]) {
+			dispatch(e)
+		}
+	}
+}
+
+func addWatch(dir string, key string, callback func()) error {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+
+	if fd < 0 {
+		newFd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+		if err != nil {
+			return err
+		}
+		fd = newFd
+		go run(fd)
+	}
+
+	wd, err := syscall.InotifyAddWatch(fd, dir, watchMask)
+	if err != nil {
+		return err
+	}
+	dirs[int32(wd)] = dir //nolint:gosec
+	callbacks[key] = append(callbacks[key], callback)
+
+	return nil
+}
+
+// Watch calls callback whenever the file at path is written, replaced or
+// removed. The parent directory is watched, so it must exist, while the file
+// itself may be created later. A removed directory is watched again once it
+// is recreated. Note that sysfs attributes only report writes
+// from user space, not changes made by the kernel itself.
+func Watch(path string, callback func()) error {
+	path = filepath.Clean(path)
+	return addWatch(filepath.Dir(path), path, callback)
+}
+
+// WatchDir calls callback whenever any file in dir is written, created,
+// replaced or removed, or dir itself is recreated.
+func WatchDir(dir string, callback func()) error {
+	dir = filepath.Clean(dir)
+	return addWatch(dir, dir, callback)
+}
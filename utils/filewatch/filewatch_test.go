@@ -0,0 +1,156 @@
+package filewatch
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/natefinch/atomic"
+)
+
+func encodeEvent(wd int32, mask uint32, name string) []byte {
+	nameLen := (len(name) + 16) / 16 * 16
+	buf := make([]byte, syscall.SizeofInotifyEvent+nameLen)
+	binary.NativeEndian.PutUint32(buf[0:], uint32(wd)) //nolint:gosec
+	binary.NativeEndian.PutUint32(buf[4:], mask)
+	binary.NativeEndian.PutUint32(buf[12:], uint32(nameLen)) //nolint:gosec
+	copy(buf[syscall.SizeofInotifyEvent:], name)
+	return buf
+}
+
+func TestParseEvents(t *testing.T) {
+	buf := append(encodeEvent(1, syscall.IN_MODIFY, "config.txt"), encodeEvent(2, syscall.IN_MOVED_TO, "90-os-agent.conf")...)
+	buf = append(buf, encodeEvent(3, syscall.IN_DELETE, "")...)
+
+	events := parseEvents(buf)
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %v", events)
+	}
+	if events[0].wd != 1 || events[0].mask != syscall.IN_MODIFY || events[0].name != "config.txt" {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+	if events[1].name != "90-os-agent.conf" || events[2].name != "" {
+		t.Errorf("unexpected events %+v", events)
+	}
+
+	// A truncated event is ignored
+	if events := parseEvents(buf[:len(buf)-4]); len(events) != 2 {
+		t.Errorf("expected 2 complete events, got %v", events)
+	}
+}
+
+func waitFor(t *testing.T, changes chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no callback after %s", what)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.conf")
+
+	changes := make(chan struct{}, 10)
+	if err := Watch(path, func() { changes <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, changes, "creating the file")
+
+	if err := atomic.WriteFile(path, strings.NewReader("b\n")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, changes, "replacing the file")
+
+	// Other files in the directory are ignored
+	if err := os.WriteFile(filepath.Join(dir, "other.conf"), []byte("c\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+		t.Error("unexpected callback for another file")
+	case <-time.After(2 * debounceDelay):
+	}
+}
+
+func TestWatchDir(t *testing.T) {
+	dir := t.TempDir()
+
+	changes := make(chan struct{}, 10)
+	if err := WatchDir(dir, func() { changes <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "10-first.conf"), []byte("a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, changes, "creating a file")
+
+	if err := os.Remove(filepath.Join(dir, "10-first.conf")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, changes, "removing a file")
+}
+
+func TestWatchOverflow(t *testing.T) {
+	dir := t.TempDir()
+
+	changes := make(chan struct{}, 10)
+	if err := Watch(filepath.Join(dir, "test.conf"), func() { changes <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+	if err := WatchDir(t.TempDir(), func() { changes <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every watched path is refreshed when events were lost
+	dispatch(event{wd: -1, mask: syscall.IN_Q_OVERFLOW})
+	waitFor(t, changes, "the first refresh on overflow")
+	waitFor(t, changes, "the second refresh on overflow")
+}
+
+func TestWatchRecreatedDir(t *testing.T) {
+	watchMu.Lock()
+	previous := rewatchInterval
+	rewatchInterval = 50 * time.Millisecond
+	watchMu.Unlock()
+	t.Cleanup(func() {
+		watchMu.Lock()
+		rewatchInterval = previous
+		watchMu.Unlock()
+	})
+
+	dir := filepath.Join(t.TempDir(), "timesyncd.conf.d")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan struct{}, 10)
+	if err := WatchDir(dir, func() { changes <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, changes, "removing the directory")
+
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, changes, "recreating the directory")
+
+	// Changes in the recreated directory are seen again
+	if err := os.WriteFile(filepath.Join(dir, "10-first.conf"), []byte("a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, changes, "creating a file in the recreated directory")
+}
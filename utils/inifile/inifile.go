@@ -0,0 +1,285 @@
+package inifile
+
+import (
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	logging "github.com/home-assistant/os-agent/utils/log"
+	"github.com/natefinch/atomic"
+)
+
+// IniFile edits systemd-style configuration files. Lines which are not
+// touched by an edit are kept verbatim, including comments and blank lines.
+type IniFile struct {
+	FilePath string
+}
+
+// Assignment is a single key=value line of a section. Keys may be assigned
+// repeatedly, e.g. for list options.
+type Assignment struct {
+	Key   string
+	Value string
+}
+
+type entry struct {
+	// first and last physical line, more than one for continuation lines
+	start     int
+	end       int
+	section   string
+	key       string
+	value     string
+	commented bool
+}
+
+type section struct {
+	name string
+	// last non-blank line of the section, new keys are inserted after it
+	lastLine int
+}
+
+type document struct {
+	lines    []string
+	entries  []entry
+	sections []section
+}
+
+var commentedKeyRegexp = regexp.MustCompile(`^[#;]\s*([A-Za-z0-9_.\-]+)\s*=`)
+
+func parse(content string) document {
+	doc := document{}
+	if content != "" {
+		doc.lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	current := ""
+	for idx := 0; idx < len(doc.lines); idx++ {
+		line := strings.TrimSpace(doc.lines[idx])
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			doc.sections = append(doc.sections, section{name: current, lastLine: idx})
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			if m := commentedKeyRegexp.FindStringSubmatch(line); m != nil {
+				doc.entries = append(doc.entries, entry{start: idx, end: idx, section: current, key: m[1], commented: true})
+			}
+		default:
+			key, value, found := strings.Cut(line, "=")
+			if !found {
+				continue
+			}
+
+			start := idx
+			value = strings.TrimSpace(value)
+			for strings.HasSuffix(value, "\\") && idx+1 < len(doc.lines) {
+				idx++
+				value = strings.TrimSpace(strings.TrimSuffix(value, "\\")) + " " + strings.TrimSpace(doc.lines[idx])
+			}
+			value = strings.TrimSpace(strings.TrimSuffix(value, "\\"))
+
+			doc.entries = append(doc.entries, entry{start: start, end: idx, section: current, key: strings.TrimSpace(key), value: value})
+		}
+
+		if len(doc.sections) > 0 {
+			doc.sections[len(doc.sections)-1].lastLine = idx
+		}
+	}
+
+	return doc
+}
+
+func (d document) find(sectionName string, key string, commented bool) []entry {
+	var found []entry
+	for _, e := range d.entries {
+		if e.section == sectionName && e.key == key && e.commented == commented {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func (d document) assignments(sectionName string) []Assignment {
+	var found []Assignment
+	for _, e := range d.entries {
+		if e.section == sectionName && !e.commented {
+			found = append(found, Assignment{Key: e.key, Value: e.value})
+		}
+	}
+	return found
+}
+
+// replaceLines substitutes the lines from start to end (inclusive) with the
+// given lines. An end before start inserts the lines at start.
+func replaceLines(lines []string, start int, end int, with []string) []string {
+	out := make([]string, 0, len(lines)+len(with))
+	out = append(out, lines[:start]...)
+	out = append(out, with...)
+	return append(out, lines[end+1:]...)
+}
+
+// formatAssignment renders key=value. When replacing an existing single line
+// assignment, its spacing around the delimiter is kept.
+func formatAssignment(previous string, key string, value string) string {
+	if m := regexp.MustCompile(`^(\s*` + regexp.QuoteMeta(key) + `\s*=[ \t]*)`).FindStringSubmatch(previous); m != nil && !strings.HasSuffix(strings.TrimSpace(previous), "\\") {
+		return m[1] + value
+	}
+	return key + "=" + value
+}
+
+// setAll replaces all assignments of key in the section with the values, in
+// place of the first assignment. Without an existing assignment the lines are
+// added after a commented-out default, or at the end of the section.
+func (d document) setAll(sectionName string, key string, values []string) []string {
+	lines := d.lines
+	active := d.find(sectionName, key, false)
+
+	var previous string
+	if len(active) > 0 {
+		previous = lines[active[0].start]
+	}
+	newLines := make([]string, 0, len(values))
+	for _, value := range values {
+		newLines = append(newLines, formatAssignment(previous, key, value))
+	}
+
+	if len(active) > 0 {
+		for i := len(active) - 1; i > 0; i-- {
+			lines = replaceLines(lines, active[i].start, active[i].end, nil)
+		}
+		return replaceLines(lines, active[0].start, active[0].end, newLines)
+	}
+
+	if commented := d.find(sectionName, key, true); len(commented) > 0 {
+		last := commented[len(commented)-1]
+		return replaceLines(lines, last.end+1, last.end, newLines)
+	}
+
+	for i := len(d.sections) - 1; i >= 0; i-- {
+		if d.sections[i].name == sectionName {
+			return replaceLines(lines, d.sections[i].lastLine+1, d.sections[i].lastLine, newLines)
+		}
+	}
+
+	if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+		lines = append(lines, "")
+	}
+	lines = append(lines, "["+sectionName+"]")
+	return append(lines, newLines...)
+}
+
+func (d document) unset(sectionName string, key string) []string {
+	lines := d.lines
+	active := d.find(sectionName, key, false)
+	for i := len(active) - 1; i >= 0; i-- {
+		lines = replaceLines(lines, active[i].start, active[i].end, nil)
+	}
+	return lines
+}
+
+// read parses the file, a missing file is treated as empty.
+func (f IniFile) read() (document, error) {
+	content, err := os.ReadFile(f.FilePath)
+	if os.IsNotExist(err) {
+		return document{}, nil
+	} else if err != nil {
+		logging.Error.Printf("Error reading %s: %s", f.FilePath, err)
+		return document{}, err
+	}
+
+	return parse(string(content)), nil
+}
+
+func (f IniFile) write(lines []string) error {
+	raw := strings.Join(lines, "\n") + "\n"
+
+	if err := atomic.WriteFile(f.FilePath, strings.NewReader(raw)); err != nil {
+		logging.Error.Printf("Failed to write file %s: %s", f.FilePath, err)
+		return err
+	}
+
+	return nil
+}
+
+// Get returns the effective value of key in section, i.e. its last
+// assignment. A missing file is treated as empty.
+func (f IniFile) Get(sectionName string, key string) (string, bool, error) {
+	doc, err := f.read()
+	if err != nil {
+		return "", false, err
+	}
+
+	active := doc.find(sectionName, key, false)
+	if len(active) == 0 {
+		return "", false, nil
+	}
+	return active[len(active)-1].value, true, nil
+}
+
+// GetAll returns the values of all assignments of key in section.
+func (f IniFile) GetAll(sectionName string, key string) ([]string, error) {
+	doc, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for _, e := range doc.find(sectionName, key, false) {
+		values = append(values, e.value)
+	}
+	return values, nil
+}
+
+// Assignments returns all assignments of section in file order.
+func (f IniFile) Assignments(sectionName string) ([]Assignment, error) {
+	doc, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.assignments(sectionName), nil
+}
+
+// Set assigns value to key in section, replacing any previous assignments.
+// The file and the section are created if needed.
+func (f IniFile) Set(sectionName string, key string, value string) error {
+	return f.SetAll(sectionName, key, []string{value})
+}
+
+// SetAll replaces all assignments of key in section with one assignment per
+// value, e.g. an empty one resetting a list followed by the new list. The
+// file is left untouched if it already has these assignments.
+func (f IniFile) SetAll(sectionName string, key string, values []string) error {
+	doc, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	lines := doc.setAll(sectionName, key, values)
+	if slices.Equal(lines, doc.lines) {
+		return nil
+	}
+
+	return f.write(lines)
+}
+
+// Unset removes all assignments of key in section. Commented-out lines are
+// kept.
+func (f IniFile) Unset(sectionName string, key string) error {
+	doc, err := f.read()
+	if err != nil {
+		return err
+	}
+	if len(doc.find(sectionName, key, false)) == 0 {
+		return nil
+	}
+
+	return f.write(doc.unset(sectionName, key))
+}
@@ -0,0 +1,202 @@
+package inifile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const contentJournald = `#  This file is part of systemd.
+#
+# Entries in this file show the compile time defaults.
+
+[Journal]
+#Storage=auto
+Compress = yes
+SystemMaxUse=64M
+#SystemKeepFree=
+ExecArgs=one \
+  two \
+  three
+
+[Other]
+Storage=volatile
+`
+
+func set(t *testing.T, content string, section string, key string, values ...string) string {
+	t.Helper()
+	return strings.Join(parse(content).setAll(section, key, values), "\n") + "\n"
+}
+
+func TestGet(t *testing.T) {
+	doc := parse(contentJournald)
+
+	if got := doc.find("Journal", "SystemMaxUse", false); len(got) != 1 || got[0].value != "64M" {
+		t.Errorf("unexpected SystemMaxUse entries %v", got)
+	}
+	if got := doc.find("Journal", "Storage", false); len(got) != 0 {
+		t.Errorf("commented-out key must not be found, got %v", got)
+	}
+	if got := doc.find("Other", "Storage", false); len(got) != 1 || got[0].value != "volatile" {
+		t.Errorf("unexpected Storage entries in [Other] %v", got)
+	}
+	if got := doc.find("Journal", "ExecArgs", false); len(got) != 1 || got[0].value != "one two three" {
+		t.Errorf("unexpected continuation value %v", got)
+	}
+	if got := doc.find("Journal", "Compress", false); len(got) != 1 || got[0].value != "yes" {
+		t.Errorf("unexpected Compress entries %v", got)
+	}
+}
+
+func TestSetReplacesKeepingFormat(t *testing.T) {
+	got := set(t, contentJournald, "Journal", "Compress", "no")
+	want := strings.Replace(contentJournald, "Compress = yes", "Compress = no", 1)
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestSetAfterCommentedDefault(t *testing.T) {
+	got := set(t, contentJournald, "Journal", "Storage", "persistent")
+	want := strings.Replace(contentJournald, "#Storage=auto\n", "#Storage=auto\nStorage=persistent\n", 1)
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestSetAppendsToSection(t *testing.T) {
+	got := set(t, contentJournald, "Journal", "MaxRetentionSec", "1month")
+	want := strings.Replace(contentJournald, "  three\n", "  three\nMaxRetentionSec=1month\n", 1)
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestSetContinuation(t *testing.T) {
+	got := set(t, contentJournald, "Journal", "ExecArgs", "four")
+	want := strings.Replace(contentJournald, "ExecArgs=one \\\n  two \\\n  three\n", "ExecArgs=four\n", 1)
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestSetNewSection(t *testing.T) {
+	got := set(t, contentJournald, "Upload", "URL", "http://example.com")
+	want := contentJournald + "\n[Upload]\nURL=http://example.com\n"
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	got = set(t, "", "Time", "NTP", "ntp.example.com")
+	if got != "[Time]\nNTP=ntp.example.com\n" {
+		t.Errorf("unexpected content for empty file: %q", got)
+	}
+}
+
+func TestSetAllRepeatedKeys(t *testing.T) {
+	content := "[Resolve]\nDNS=1.1.1.1\nDNSSEC=no\nDNS=8.8.8.8\n"
+	got := set(t, content, "Resolve", "DNS", "", "9.9.9.9 149.112.112.112")
+	want := "[Resolve]\nDNS=\nDNS=9.9.9.9 149.112.112.112\nDNSSEC=no\n"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestSetRepeatedSection(t *testing.T) {
+	content := "[Time]\nNTP=a\n\n[Other]\nKey=value\n\n[Time]\nFallbackNTP=b\n"
+	got := set(t, content, "Time", "PollIntervalMinSec", "64")
+	want := content + "PollIntervalMinSec=64\n"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestUnset(t *testing.T) {
+	content := "[Resolve]\n#DNS=\nDNS=1.1.1.1\nDNSSEC=no\nDNS=8.8.8.8 \\\n  8.8.4.4\n"
+	got := strings.Join(parse(content).unset("Resolve", "DNS"), "\n") + "\n"
+	want := "[Resolve]\n#DNS=\nDNSSEC=no\n"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logind.conf")
+	f := IniFile{FilePath: path}
+
+	if _, ok, err := f.Get("Login", "HandlePowerKey"); ok || err != nil {
+		t.Fatalf("expected missing key in missing file, got %t / %v", ok, err)
+	}
+	if err := f.Unset("Login", "HandlePowerKey"); err != nil {
+		t.Fatalf("unset on missing file failed: %s", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("unset must not create the file")
+	}
+
+	if err := f.Set("Login", "HandlePowerKey", "poweroff"); err != nil {
+		t.Fatalf("set failed: %s", err)
+	}
+	if err := f.Set("Login", "IdleAction", "ignore"); err != nil {
+		t.Fatalf("set failed: %s", err)
+	}
+	if err := f.Set("Login", "HandlePowerKey", "reboot"); err != nil {
+		t.Fatalf("set failed: %s", err)
+	}
+
+	value, ok, err := f.Get("Login", "HandlePowerKey")
+	if err != nil || !ok || value != "reboot" {
+		t.Errorf("unexpected value %q (%t, %v)", value, ok, err)
+	}
+
+	assignments, err := f.Assignments("Login")
+	if err != nil {
+		t.Fatalf("failed to read assignments: %s", err)
+	}
+	want := []Assignment{{"HandlePowerKey", "reboot"}, {"IdleAction", "ignore"}}
+	if !reflect.DeepEqual(assignments, want) {
+		t.Errorf("Assignments() = %v, want %v", assignments, want)
+	}
+
+	content, _ := os.ReadFile(path)
+	if string(content) != "[Login]\nHandlePowerKey=reboot\nIdleAction=ignore\n" {
+		t.Errorf("unexpected file content %q", content)
+	}
+}
+
+func TestSetUnchangedKeepsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journald.conf")
+	if err := os.WriteFile(path, []byte(contentJournald), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	f := IniFile{FilePath: path}
+	if err := f.Set("Journal", "SystemMaxUse", "64M"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetAll("Other", "Storage", []string{"volatile"}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("file was rewritten without a change")
+	}
+
+	if err := f.Set("Journal", "SystemMaxUse", "128M"); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.ModTime().Equal(old) {
+		t.Errorf("file was not written on a change")
+	}
+}
@@ -0,0 +1,68 @@
+package inifile
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ConfigFiles returns the main configuration file name followed by all its
+// drop-ins in the order systemd applies them, given the configuration
+// directories in order of precedence. A drop-in in a directory of higher
+// precedence masks one with the same name in a lower one.
+func ConfigFiles(roots []string, name string) []string {
+	var files []string
+	for _, root := range roots {
+		path := filepath.Join(root, name)
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+			break
+		}
+	}
+
+	dropIns := map[string]string{}
+	for i := len(roots) - 1; i >= 0; i-- {
+		matches, _ := filepath.Glob(filepath.Join(roots[i], name+".d", "*.conf"))
+		for _, match := range matches {
+			dropIns[filepath.Base(match)] = match
+		}
+	}
+
+	names := make([]string, 0, len(dropIns))
+	for name := range dropIns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		files = append(files, dropIns[name])
+	}
+
+	return files
+}
+
+// Merge returns the effective options of section over the given files, as
+// returned by ConfigFiles. Options never assigned are missing from the
+// result. Options in listKeys accumulate over all assignments and are space
+// separated, an empty assignment resets the list. All other options use the
+// last assignment.
+func Merge(files []string, sectionName string, listKeys map[string]bool) map[string]string {
+	options := map[string]string{}
+	for _, file := range files {
+		assignments, err := IniFile{FilePath: file}.Assignments(sectionName)
+		if err != nil {
+			continue
+		}
+
+		for _, a := range assignments {
+			current, set := options[a.Key]
+			if listKeys[a.Key] && a.Value != "" && set && current != "" {
+				options[a.Key] = current + " " + strings.Join(strings.Fields(a.Value), " ")
+			} else {
+				options[a.Key] = strings.Join(strings.Fields(a.Value), " ")
+			}
+		}
+	}
+
+	return options
+}
@@ -6,13 +6,21 @@ import (
 	"strings"
 )
 
+// ClassPath is the sysfs directory holding the LED class devices.
+var ClassPath = "/sys/class/leds"
+
 type LED struct {
 	Name           string
 	DefaultTrigger string
 }
 
+// TriggerPath returns the sysfs attribute holding the trigger of the LED.
+func (led LED) TriggerPath() string {
+	return filepath.Join(ClassPath, led.Name, "trigger")
+}
+
 func (led LED) GetTrigger() (string, error) {
-	ledTriggerFilePath := filepath.Join("/sys/class/leds/", led.Name, "trigger")
+	ledTriggerFilePath := led.TriggerPath()
 	ledTrigger, err := os.ReadFile(ledTriggerFilePath)
 	if err != nil {
 		return "", err
@@ -21,7 +29,7 @@ func (led LED) GetTrigger() (string, error) {
 }
 
 func (led LED) SetTrigger(newState bool) error {
-	ledTriggerFilePath := filepath.Join("/sys/class/leds/", led.Name, "trigger")
+	ledTriggerFilePath := led.TriggerPath()
 	var newTrigger []byte
 
 	if newState {
@@ -6,6 +6,7 @@ import (
 	"github.com/natefinch/atomic"
 	"os"
 	re "regexp"
+	"slices"
 	"strings"
 )
 
@@ -26,6 +27,15 @@ type Params struct {
 	Before string
 }
 
+// Match is a line found by FindAll.
+type Match struct {
+	// LineNumber of the match, starting at 1
+	LineNumber int
+	Line       string
+	// Groups holds the values of all named capture groups of the expression
+	Groups map[string]string
+}
+
 func NewPresentParams(line string) Params {
 	params := Params{
 		Line:   line,
@@ -47,19 +57,26 @@ func NewAbsentParams() Params {
 }
 
 func (l LineInFile) Present(params Params) error {
+	_, err := l.PresentChanged(params)
+	return err
+}
+
+// PresentChanged works like Present and reports whether the file was
+// modified. The file is not written if the line is already present.
+func (l LineInFile) PresentChanged(params Params) (bool, error) {
 	createFile := false
 	if _, err := os.Stat(l.FilePath); os.IsNotExist(err) {
 		// will be created by atomic.WriteFile
 		createFile = true
 	} else if err != nil {
-		return err
+		return false, err
 	}
 
 	var lines []string
 	if !createFile {
 		content, err := os.ReadFile(l.FilePath)
 		if err != nil {
-			return err
+			return false, err
 		}
 
 		lines = strings.Split(string(content), "\n")
@@ -68,27 +85,38 @@ func (l LineInFile) Present(params Params) error {
 	outLines, err := processPresent(lines, params)
 	if err != nil {
 		logging.Error.Printf("Failed to process file %s: %s", l.FilePath, err)
-		return err
+		return false, err
+	}
+
+	if !createFile && slices.Equal(lines, outLines) {
+		return false, nil
 	}
 
 	err = l.writeFile(outLines)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	return true, nil
 }
 
 func (l LineInFile) Absent(params Params) error {
+	_, err := l.AbsentChanged(params)
+	return err
+}
+
+// AbsentChanged works like Absent and reports whether the file was
+// modified. The file is not written if there is no line to remove.
+func (l LineInFile) AbsentChanged(params Params) (bool, error) {
 	if _, err := os.Stat(l.FilePath); os.IsNotExist(err) {
-		return nil
+		return false, nil
 	} else if err != nil {
-		return err
+		return false, err
 	}
 
 	content, err := os.ReadFile(l.FilePath)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	lines := strings.Split(string(content), "\n")
@@ -96,15 +124,19 @@ func (l LineInFile) Absent(params Params) error {
 	outLines, err := processAbsent(lines, params)
 	if err != nil {
 		logging.Error.Printf("Failed to process file %s: %s", l.FilePath, err)
-		return err
+		return false, err
+	}
+
+	if slices.Equal(lines, outLines) {
+		return false, nil
 	}
 
 	err = l.writeFile(outLines)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	return true, nil
 }
 
 func processPresent(inLines []string, params Params) ([]string, error) {
@@ -252,6 +284,65 @@ func processFind(regexp string, after string, inLines []string) *string {
 	return nil
 }
 
+// FindAll returns all lines matching regexp which occur after the line
+// matching after (or the whole file if after is empty), including the values
+// of named capture groups.
+func (l LineInFile) FindAll(regexp string, after string, allowMissing bool) ([]Match, error) {
+	if _, err := os.Stat(l.FilePath); os.IsNotExist(err) {
+		if allowMissing {
+			return nil, nil
+		}
+		logging.Error.Printf("File %s does not exist: %s", l.FilePath, err)
+		return nil, err
+	}
+
+	content, err := os.ReadFile(l.FilePath)
+	if err != nil {
+		logging.Error.Printf("Error reading %s: %s", l.FilePath, err)
+		return nil, err
+	}
+
+	lines := strings.Split(string(content), "\n")
+
+	return processFindAll(regexp, after, lines)
+}
+
+func processFindAll(regexp string, after string, inLines []string) ([]Match, error) {
+	lineRegexp, err := re.Compile(regexp)
+	if err != nil {
+		return nil, err
+	}
+	afterRegexp, err := re.Compile(after)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Match
+	var foundAfter = after == ""
+
+	for idx, curr := range inLines {
+		if !foundAfter {
+			foundAfter = afterRegexp.MatchString(curr)
+			continue
+		}
+
+		submatches := lineRegexp.FindStringSubmatch(curr)
+		if submatches == nil {
+			continue
+		}
+
+		groups := map[string]string{}
+		for i, name := range lineRegexp.SubexpNames() {
+			if name != "" {
+				groups[name] = submatches[i]
+			}
+		}
+		matches = append(matches, Match{LineNumber: idx + 1, Line: curr, Groups: groups})
+	}
+
+	return matches, nil
+}
+
 func (l LineInFile) writeFile(lines []string) error {
 	raw := strings.Join(lines, "\n")
 	if !strings.HasSuffix(raw, "\n") {
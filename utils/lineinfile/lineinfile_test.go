@@ -1,6 +1,8 @@
 package lineinfile
 
 import (
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
@@ -227,3 +229,91 @@ func TestAbsentNoBeforeAfterRegex(t *testing.T) {
 		t.Errorf("Expected %s, got %s", expected, result)
 	}
 }
+
+func TestFindAll(t *testing.T) {
+	content := "[Time]\nNTP=a.example.com\n#NTP=commented.example.com\nFallbackNTP=b.example.com\nNTP=c.example.com\n"
+	lines := strings.Split(content, "\n")
+	matches, err := processFindAll(`^NTP=(?P<servers>.*)$`, `\[Time\]`, lines)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("Expected 2 matches, got %d", len(matches))
+	}
+	if matches[0].LineNumber != 2 || matches[0].Groups["servers"] != "a.example.com" {
+		t.Errorf("Unexpected first match %+v", matches[0])
+	}
+	if matches[1].LineNumber != 5 || matches[1].Line != "NTP=c.example.com" || matches[1].Groups["servers"] != "c.example.com" {
+		t.Errorf("Unexpected second match %+v", matches[1])
+	}
+}
+
+func TestFindAllNotAfter(t *testing.T) {
+	lines := strings.Split(contentNTPNotAfter, "\n")
+	matches, err := processFindAll(`^NTP=`, `\[Time\]`, lines)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("Expected no matches, got %+v", matches)
+	}
+}
+
+func TestFindAllInvalidRegexp(t *testing.T) {
+	if _, err := processFindAll(`^NTP=(`, "", []string{"NTP="}); err == nil {
+		t.Errorf("Expected an error, got nil")
+	}
+}
+
+func TestPresentChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timesyncd.conf")
+	file := LineInFile{FilePath: path}
+
+	params := NewPresentParams("NTP=ntp.example.com")
+	params.Regexp, _ = regexp.Compile(`^\s*#?\s*(NTP=).*$`)
+
+	changed, err := file.PresentChanged(params)
+	if err != nil || !changed {
+		t.Fatalf("Expected new file to be changed, got %t / %v", changed, err)
+	}
+
+	info, _ := os.Stat(path)
+	changed, err = file.PresentChanged(params)
+	if err != nil || changed {
+		t.Errorf("Expected no change, got %t / %v", changed, err)
+	}
+	if after, _ := os.Stat(path); !after.ModTime().Equal(info.ModTime()) {
+		t.Errorf("Expected unchanged file not to be written")
+	}
+
+	params.Line = "NTP=ntp2.example.com"
+	changed, err = file.PresentChanged(params)
+	if err != nil || !changed {
+		t.Errorf("Expected change, got %t / %v", changed, err)
+	}
+}
+
+func TestAbsentChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timesyncd.conf")
+	file := LineInFile{FilePath: path}
+
+	params := NewAbsentParams()
+	params.Regexp, _ = regexp.Compile(`^\s*(NTP=).*$`)
+
+	changed, err := file.AbsentChanged(params)
+	if err != nil || changed {
+		t.Errorf("Expected missing file to be unchanged, got %t / %v", changed, err)
+	}
+
+	if err := os.WriteFile(path, []byte(contentNTPSet), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %s", err)
+	}
+	changed, err = file.AbsentChanged(params)
+	if err != nil || !changed {
+		t.Errorf("Expected change, got %t / %v", changed, err)
+	}
+	changed, err = file.AbsentChanged(params)
+	if err != nil || changed {
+		t.Errorf("Expected no change, got %t / %v", changed, err)
+	}
+}
@@ -0,0 +1,276 @@
+package settings
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/home-assistant/os-agent/utils/filehistory"
+	logging "github.com/home-assistant/os-agent/utils/log"
+)
+
+// Properties is the part of prop.Properties used to read and write settings.
+// Writes go through Set, so property callbacks and change signals run as for
+// a write over D-Bus.
+type Properties interface {
+	Get(iface string, property string) (dbus.Variant, *dbus.Error)
+	Set(iface string, property string, value dbus.Variant) *dbus.Error
+}
+
+// Validator checks new values of writable properties of one interface
+// without applying them. All changes to the interface in a transaction are
+// passed at once, so checks spanning several properties see the new values.
+type Validator func(changes map[string]any) error
+
+// Change is a single property write of a transaction.
+type Change struct {
+	Interface string
+	Property  string
+	Value     dbus.Variant
+}
+
+type managed struct {
+	props    Properties
+	writable []string
+	files    []string
+	validate Validator
+}
+
+var (
+	registry   = map[string]managed{}
+	registryMu sync.Mutex
+	// applyMu serializes transactions.
+	applyMu sync.Mutex
+)
+
+// Register makes the writable properties of iface available to Apply. Files
+// are the configuration files written by the property callbacks. The
+// validator may be nil if the property types are all there is to check.
+func Register(iface string, props Properties, writable []string, files []string, validate Validator) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry[iface] = managed{props: props, writable: writable, files: files, validate: validate}
+}
+
+func lookup(iface string) (managed, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	m, ok := registry[iface]
+	return m, ok
+}
+
+// Supported reports whether the settings of iface are available, e.g. the
+// LED settings of a board only are on that board.
+func Supported(iface string) bool {
+	_, ok := lookup(iface)
+	return ok
+}
+
+// Current returns the current value of a registered writable property.
+func Current(iface string, property string) (dbus.Variant, error) {
+	m, ok := lookup(iface)
+	if !ok {
+		return dbus.Variant{}, fmt.Errorf("unsupported interface %s", iface)
+	}
+	if !slices.Contains(m.writable, property) {
+		return dbus.Variant{}, fmt.Errorf("unknown setting %s.%s", iface, property)
+	}
+
+	value, err := m.props.Get(iface, property)
+	if err != nil {
+		return dbus.Variant{}, fmt.Errorf("failed to read %s.%s: %s", iface, property, err.Error())
+	}
+	return value, nil
+}
+
+// Files returns the configuration files written when applying changes.
+func Files(changes []Change) []string {
+	files := []string{}
+	for _, c := range changes {
+		if m, ok := lookup(c.Interface); ok {
+			files = append(files, m.files...)
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files)
+}
+
+// Values returns the current values of all registered writable properties,
+// keyed by interface and property name, e.g. "io.hass.os.Config.Swap.SwapSize".
+func Values() (map[string]any, error) {
+	registryMu.Lock()
+	ifaces := make([]string, 0, len(registry))
+	for iface := range registry {
+		ifaces = append(ifaces, iface)
+	}
+	registryMu.Unlock()
+
+	values := map[string]any{}
+	for _, iface := range ifaces {
+		m, _ := lookup(iface)
+		for _, property := range m.writable {
+			value, err := Current(iface, property)
+			if err != nil {
+				return nil, err
+			}
+			values[iface+"."+property] = value.Value()
+		}
+	}
+
+	return values, nil
+}
+
+// Refresh updates the properties whose current value differs from the given
+// one, e.g. after a configuration file was changed outside of the agent.
+// Unchanged properties emit no signal. Returns whether any value changed.
+func Refresh(props *prop.Properties, iface string, values map[string]any) bool {
+	changed := false
+	for name, value := range values {
+		if !reflect.DeepEqual(props.GetMust(iface, name), value) {
+			props.SetMust(iface, name, value)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// ParseKey splits a key like "Config.Swap.SwapSize" into the interface
+// below prefix and the property name.
+func ParseKey(prefix string, key string) (string, string, error) {
+	idx := strings.LastIndex(key, ".")
+	if idx <= 0 || idx == len(key)-1 {
+		return "", "", fmt.Errorf("invalid setting %q", key)
+	}
+	return prefix + key[:idx], key[idx+1:], nil
+}
+
+// validate checks that all changes target registered properties with the
+// right type, and that every interface accepts its new values.
+func validate(changes []Change) (map[string]dbus.Variant, error) {
+	previous := map[string]dbus.Variant{}
+	byIface := map[string]map[string]any{}
+
+	for _, c := range changes {
+		current, err := Current(c.Interface, c.Property)
+		if err != nil {
+			return nil, err
+		}
+		if current.Signature() != c.Value.Signature() {
+			return nil, fmt.Errorf("%s.%s must be of type %s, got %s", c.Interface, c.Property, current.Signature(), c.Value.Signature())
+		}
+		previous[c.Interface+"."+c.Property] = current
+
+		if byIface[c.Interface] == nil {
+			byIface[c.Interface] = map[string]any{}
+		}
+		byIface[c.Interface][c.Property] = c.Value.Value()
+	}
+
+	for iface, values := range byIface {
+		m, _ := lookup(iface)
+		if m.validate == nil {
+			continue
+		}
+		if err := m.validate(values); err != nil {
+			return nil, fmt.Errorf("%s: %w", iface, err)
+		}
+	}
+
+	return previous, nil
+}
+
+// Validate checks changes the way Apply does, without writing them.
+func Validate(changes []Change) error {
+	_, err := validate(changes)
+	return err
+}
+
+// write sets the changes through the property callbacks. A callback may
+// check its value against a sibling property which is still to be written,
+// e.g. when raising both of a warning and a critical threshold, so failed
+// writes are retried once the others succeeded. Returns the changes written.
+func write(changes []Change) ([]Change, error) {
+	var written []Change
+	pending := changes
+	for len(pending) > 0 {
+		var failed []Change
+		var firstErr error
+		for _, c := range pending {
+			m, _ := lookup(c.Interface)
+			if err := m.props.Set(c.Interface, c.Property, c.Value); err != nil {
+				failed = append(failed, c)
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to set %s.%s: %s", c.Interface, c.Property, err.Error())
+				}
+				continue
+			}
+			written = append(written, c)
+		}
+
+		if len(failed) == len(pending) {
+			return written, firstErr
+		}
+		pending = failed
+	}
+
+	return written, nil
+}
+
+// Apply validates all changes first and then writes them. If a write fails,
+// the changes written so far are undone.
+func Apply(changes []Change) error {
+	applyMu.Lock()
+	defer applyMu.Unlock()
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Interface != changes[j].Interface {
+			return changes[i].Interface < changes[j].Interface
+		}
+		return changes[i].Property < changes[j].Property
+	})
+
+	previous, err := validate(changes)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := filehistory.TakeSnapshot(Files(changes))
+	if err != nil {
+		return fmt.Errorf("failed to read the configuration: %w", err)
+	}
+
+	written, err := write(changes)
+	if err != nil {
+		rollback(written, previous, snapshot)
+		return err
+	}
+
+	return nil
+}
+
+// rollback writes the previous values back through the callbacks, so the
+// interfaces update any state they keep besides their files. The callbacks
+// may write defaults or values of other configuration files into the files,
+// so the files are restored byte for byte afterwards.
+func rollback(written []Change, previous map[string]dbus.Variant, snapshot filehistory.Snapshot) {
+	restore := make([]Change, 0, len(written))
+	for i := len(written) - 1; i >= 0; i-- {
+		c := written[i]
+		restore = append(restore, Change{Interface: c.Interface, Property: c.Property, Value: previous[c.Interface+"."+c.Property]})
+	}
+
+	if _, err := write(restore); err != nil {
+		logging.Error.Printf("Failed to restore previous settings: %s", err)
+	}
+	if err := snapshot.Restore(); err != nil {
+		logging.Error.Printf("Failed to restore configuration files: %s", err)
+	}
+}
@@ -0,0 +1,275 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// fakeProperties stores values and fails writes of failProperty.
+type fakeProperties struct {
+	values       map[string]any
+	failProperty string
+	writes       []string
+}
+
+func (p *fakeProperties) Get(iface string, property string) (dbus.Variant, *dbus.Error) {
+	value, ok := p.values[property]
+	if !ok {
+		return dbus.Variant{}, dbus.MakeFailedError(errors.New("unknown property"))
+	}
+	return dbus.MakeVariant(value), nil
+}
+
+func (p *fakeProperties) Set(iface string, property string, value dbus.Variant) *dbus.Error {
+	p.writes = append(p.writes, property)
+	if property == p.failProperty {
+		return dbus.MakeFailedError(errors.New("write failed"))
+	}
+	p.values[property] = value.Value()
+	return nil
+}
+
+func setup(t *testing.T) *fakeProperties {
+	t.Helper()
+	props := &fakeProperties{values: map[string]any{"Size": "1G", "Level": int32(60), "Enabled": true, "Synchronized": true}}
+	Register("io.hass.os.Test", props, []string{"Size", "Level", "Enabled"}, nil, func(changes map[string]any) error {
+		if level, ok := changes["Level"].(int32); ok && level > 100 {
+			return errors.New("level too high")
+		}
+		return nil
+	})
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "io.hass.os.Test")
+		registryMu.Unlock()
+	})
+	return props
+}
+
+func TestParseKey(t *testing.T) {
+	iface, property, err := ParseKey("io.hass.os.", "Config.Swap.SwapSize")
+	if err != nil || iface != "io.hass.os.Config.Swap" || property != "SwapSize" {
+		t.Errorf("unexpected result %q, %q, %v", iface, property, err)
+	}
+
+	for _, key := range []string{"", "SwapSize", ".SwapSize", "Config.Swap."} {
+		if _, _, err := ParseKey("io.hass.os.", key); err == nil {
+			t.Errorf("ParseKey(%q) expected an error", key)
+		}
+	}
+}
+
+func TestValues(t *testing.T) {
+	setup(t)
+
+	values, err := Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 3 || values["io.hass.os.Test.Size"] != "1G" || values["io.hass.os.Test.Level"] != int32(60) {
+		t.Errorf("unexpected values %v", values)
+	}
+	if !Supported("io.hass.os.Test") || Supported("io.hass.os.Other") {
+		t.Errorf("unexpected Supported result")
+	}
+}
+
+func TestReadOnlyProperty(t *testing.T) {
+	props := setup(t)
+
+	if _, err := Current("io.hass.os.Test", "Synchronized"); err == nil {
+		t.Errorf("expected an error reading a read-only property")
+	}
+	values, err := Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := values["io.hass.os.Test.Synchronized"]; ok {
+		t.Errorf("read-only property included in %v", values)
+	}
+
+	err = Apply([]Change{{Interface: "io.hass.os.Test", Property: "Synchronized", Value: dbus.MakeVariant(false)}})
+	if err == nil {
+		t.Errorf("expected an error writing a read-only property")
+	}
+	if props.values["Synchronized"] != true || len(props.writes) != 0 {
+		t.Errorf("read-only property was written: %v", props.writes)
+	}
+}
+
+func TestApply(t *testing.T) {
+	props := setup(t)
+
+	err := Apply([]Change{
+		{Interface: "io.hass.os.Test", Property: "Size", Value: dbus.MakeVariant("2G")},
+		{Interface: "io.hass.os.Test", Property: "Level", Value: dbus.MakeVariant(int32(10))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props.values["Size"] != "2G" || props.values["Level"] != int32(10) {
+		t.Errorf("unexpected values %v", props.values)
+	}
+}
+
+func TestApplyValidatesFirst(t *testing.T) {
+	invalid := [][]Change{
+		{{Interface: "io.hass.os.Test", Property: "Level", Value: dbus.MakeVariant(int32(200))}},
+		{{Interface: "io.hass.os.Test", Property: "Level", Value: dbus.MakeVariant("high")}},
+		{{Interface: "io.hass.os.Test", Property: "Missing", Value: dbus.MakeVariant(true)}},
+		{{Interface: "io.hass.os.Test", Property: "Synchronized", Value: dbus.MakeVariant(false)}},
+		{{Interface: "io.hass.os.Other", Property: "Level", Value: dbus.MakeVariant(int32(1))}},
+	}
+
+	for _, changes := range invalid {
+		props := setup(t)
+		changes = append([]Change{{Interface: "io.hass.os.Test", Property: "Enabled", Value: dbus.MakeVariant(false)}}, changes...)
+		if err := Apply(changes); err == nil {
+			t.Errorf("Apply(%v) expected an error", changes)
+		}
+		if len(props.writes) != 0 {
+			t.Errorf("expected no writes for invalid changes, got %v", props.writes)
+		}
+	}
+}
+
+func TestApplyRollback(t *testing.T) {
+	props := setup(t)
+	props.failProperty = "Size"
+
+	err := Apply([]Change{
+		{Interface: "io.hass.os.Test", Property: "Size", Value: dbus.MakeVariant("2G")},
+		{Interface: "io.hass.os.Test", Property: "Enabled", Value: dbus.MakeVariant(false)},
+		{Interface: "io.hass.os.Test", Property: "Level", Value: dbus.MakeVariant(int32(10))},
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// Enabled and Level are written before Size, which is retried once, and
+	// restored afterwards
+	if props.values["Enabled"] != true || props.values["Level"] != int32(60) {
+		t.Errorf("expected previous values to be restored, got %v", props.values)
+	}
+	expected := []string{"Enabled", "Level", "Size", "Size", "Level", "Enabled"}
+	if len(props.writes) != len(expected) {
+		t.Fatalf("expected writes %v, got %v", expected, props.writes)
+	}
+	for i := range expected {
+		if props.writes[i] != expected[i] {
+			t.Errorf("expected writes %v, got %v", expected, props.writes)
+			break
+		}
+	}
+}
+
+// thresholdProperties checks each write against the current value of the
+// sibling threshold, like the property callbacks of a threshold pair do.
+type thresholdProperties struct {
+	values map[string]any
+}
+
+func (p *thresholdProperties) Get(iface string, property string) (dbus.Variant, *dbus.Error) {
+	return dbus.MakeVariant(p.values[property]), nil
+}
+
+func (p *thresholdProperties) Set(iface string, property string, value dbus.Variant) *dbus.Error {
+	warning, critical := p.values["Warning"].(uint32), p.values["Critical"].(uint32)
+	if property == "Warning" {
+		warning = value.Value().(uint32)
+	} else {
+		critical = value.Value().(uint32)
+	}
+	if warning > critical {
+		return dbus.MakeFailedError(errors.New("warning exceeds critical"))
+	}
+	p.values[property] = value.Value()
+	return nil
+}
+
+func TestApplySiblingOrder(t *testing.T) {
+	props := &thresholdProperties{values: map[string]any{"Warning": uint32(80), "Critical": uint32(90)}}
+	Register("io.hass.os.Test.Pair", props, []string{"Warning", "Critical"}, nil, nil)
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "io.hass.os.Test.Pair")
+		registryMu.Unlock()
+	})
+
+	// Critical is written first, raising both only works the other way round
+	for _, values := range [][2]uint32{{20, 30}, {95, 98}, {50, 60}} {
+		err := Apply([]Change{
+			{Interface: "io.hass.os.Test.Pair", Property: "Warning", Value: dbus.MakeVariant(values[0])},
+			{Interface: "io.hass.os.Test.Pair", Property: "Critical", Value: dbus.MakeVariant(values[1])},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if props.values["Warning"] != values[0] || props.values["Critical"] != values[1] {
+			t.Errorf("unexpected values %v", props.values)
+		}
+	}
+}
+
+// fileProperties persists each value in a file of its own, dropping anything
+// else in the file like a callback rewriting its configuration does.
+type fileProperties struct {
+	dir    string
+	values map[string]any
+}
+
+func (p *fileProperties) Get(iface string, property string) (dbus.Variant, *dbus.Error) {
+	return dbus.MakeVariant(p.values[property]), nil
+}
+
+func (p *fileProperties) Set(iface string, property string, value dbus.Variant) *dbus.Error {
+	content := fmt.Sprintf("%s=%v\n", property, value.Value())
+	if err := os.WriteFile(filepath.Join(p.dir, property), []byte(content), 0o600); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	p.values[property] = value.Value()
+	return nil
+}
+
+func TestApplyRestoresFiles(t *testing.T) {
+	setup(t).failProperty = "Size"
+	dir := t.TempDir()
+	props := &fileProperties{dir: dir, values: map[string]any{"Name": "default", "Mode": "auto"}}
+	files := []string{filepath.Join(dir, "Name"), filepath.Join(dir, "Mode")}
+	Register("io.hass.os.Test.Files", props, []string{"Name", "Mode"}, files, nil)
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "io.hass.os.Test.Files")
+		registryMu.Unlock()
+	})
+
+	// Name is the default and not persisted, Mode was edited by hand
+	handEdited := "# set by hand\nMode=auto\n"
+	if err := os.WriteFile(files[1], []byte(handEdited), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Apply([]Change{
+		{Interface: "io.hass.os.Test.Files", Property: "Name", Value: dbus.MakeVariant("new")},
+		{Interface: "io.hass.os.Test.Files", Property: "Mode", Value: dbus.MakeVariant("manual")},
+		{Interface: "io.hass.os.Test", Property: "Size", Value: dbus.MakeVariant("2G")},
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if props.values["Name"] != "default" || props.values["Mode"] != "auto" {
+		t.Errorf("expected previous values to be restored, got %v", props.values)
+	}
+	if _, err := os.Stat(files[0]); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed again, got %v", files[0], err)
+	}
+	if content, _ := os.ReadFile(files[1]); string(content) != handEdited {
+		t.Errorf("expected %s to be restored, got %q", files[1], content)
+	}
+}
@@ -0,0 +1,45 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	systemddbus "github.com/coreos/go-systemd/v22/dbus"
+)
+
+const (
+	unitJobMode = "replace"
+	// jobTimeout limits how long to wait for systemd to finish a job.
+	jobTimeout = 60 * time.Second
+	jobDone    = "done"
+)
+
+// RestartUnit restarts (or starts, if it is not running) the given unit and
+// waits until systemd finished the job. An error is returned unless the job
+// completed successfully.
+func RestartUnit(unit string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+
+	conn, err := systemddbus.NewSystemConnectionContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+	defer conn.Close()
+
+	result := make(chan string, 1)
+	if _, err := conn.RestartUnitContext(ctx, unit, unitJobMode, result); err != nil {
+		return err
+	}
+
+	select {
+	case status := <-result:
+		if status != jobDone {
+			return fmt.Errorf("restart job of %s finished with result %q", unit, status)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("restart job of %s did not finish: %w", unit, ctx.Err())
+	}
+}